@@ -0,0 +1,115 @@
+package gote
+
+import (
+	"encoding/binary"
+	"hash"
+	"sync"
+)
+
+// Directions recorded by an AuditConn.
+const (
+	auditIn  = 'i'
+	auditOut = 'o'
+)
+
+// AuditConn wraps a Connection and hashes all the decoded data passing through it,
+// in both directions, so a session transcript can be checked against its digest
+// later. Each Read, ReadEvent, TryRead, OnData chunk and Write is hashed as a record of its
+// direction, its length and its data, so the digest also covers how the two
+// directions interleaved. Negotiation isn't included, only data.
+type AuditConn struct {
+	Connection
+
+	mu  sync.Mutex
+	h   hash.Hash
+	sum []byte
+}
+
+// NewAuditConn returns c wrapped to hash its data into h, such as sha256.New().
+func NewAuditConn(c Connection, h hash.Hash) *AuditConn {
+	return &AuditConn{Connection: c, h: h}
+}
+
+func (a *AuditConn) record(dir byte, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	var hdr [5]byte
+	hdr[0] = dir
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(b)))
+	a.mu.Lock()
+	if a.sum == nil {
+		a.h.Write(hdr[:])
+		a.h.Write(b)
+	}
+	a.mu.Unlock()
+}
+
+// Read reads from the connection and records the data.
+func (a *AuditConn) Read(b []byte) (int, error) {
+	n, err := a.Connection.Read(b)
+	a.record(auditIn, b[:n])
+	return n, err
+}
+
+// ReadEvent reads data or an option change from the connection and records the data.
+func (a *AuditConn) ReadEvent(b []byte) (int, *Event, error) {
+	n, ev, err := a.Connection.ReadEvent(b)
+	a.record(auditIn, b[:n])
+	return n, ev, err
+}
+
+// TryRead reads buffered data without blocking and records it.
+func (a *AuditConn) TryRead(b []byte) (int, bool) {
+	n, ok := a.Connection.TryRead(b)
+	a.record(auditIn, b[:n])
+	return n, ok
+}
+
+// OnData registers fn, recording every chunk before it is passed on.
+func (a *AuditConn) OnData(fn func(b []byte)) {
+	if fn == nil {
+		a.Connection.OnData(nil)
+		return
+	}
+	a.Connection.OnData(func(b []byte) {
+		a.record(auditIn, b)
+		fn(b)
+	})
+}
+
+// Write writes to the connection and records what was written.
+func (a *AuditConn) Write(b []byte) (int, error) {
+	n, err := a.Connection.Write(b)
+	a.record(auditOut, b[:n])
+	return n, err
+}
+
+// WriteNoTranslate writes without newline translation and records what was written.
+func (a *AuditConn) WriteNoTranslate(b []byte) (int, error) {
+	n, err := a.Connection.WriteNoTranslate(b)
+	a.record(auditOut, b[:n])
+	return n, err
+}
+
+// Close closes the connection and fixes the digest. Nothing is recorded after Close.
+func (a *AuditConn) Close() error {
+	err := a.Connection.Close()
+	a.mu.Lock()
+	if a.sum == nil {
+		a.sum = a.h.Sum(nil)
+	}
+	a.mu.Unlock()
+	return err
+}
+
+// Sum returns the digest of the data recorded so far, or the final digest once
+// Close was called.
+func (a *AuditConn) Sum() []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.sum != nil {
+		return a.sum
+	}
+	return a.h.Sum(nil)
+}
@@ -0,0 +1,50 @@
+package gote
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditConn(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	a := NewAuditConn(tel, sha256.New())
+
+	a.Write([]byte("ls\n"))
+	assert.NoError(t, server.Expect([]byte("ls\n"), time.Second))
+	server.Write([]byte{'o', 'k', IAC, NOP})
+	b := make([]byte, 2)
+	_, err := ReadFull(a, b)
+	assert.NoError(t, err)
+	// data read along with option changes is recorded too
+	server.Write([]byte{'!', IAC, WILL, ECHO})
+	n, ev, err := a.ReadEvent(b)
+	assert.NoError(t, err)
+	assert.Nil(t, ev)
+	assert.Equal(t, 1, n)
+
+	expected := sha256.New()
+	for _, r := range []struct {
+		dir  byte
+		data string
+	}{{'o', "ls\n"}, {'i', "ok"}, {'i', "!"}} {
+		var hdr [5]byte
+		hdr[0] = r.dir
+		binary.BigEndian.PutUint32(hdr[1:], uint32(len(r.data)))
+		expected.Write(hdr[:])
+		expected.Write([]byte(r.data))
+	}
+	assert.Equal(t, expected.Sum(nil), a.Sum())
+
+	assert.NoError(t, a.Close())
+	sum := a.Sum()
+	assert.Equal(t, expected.Sum(nil), sum)
+	a.Write([]byte("late"))
+	assert.Equal(t, sum, a.Sum())
+}
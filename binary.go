@@ -0,0 +1,11 @@
+package gote
+
+// binaryOption agrees to binary transmission (RFC 856) in both directions.
+type binaryOption struct {
+	BaseOption
+}
+
+// Accept agrees to WILL and DO BINARY.
+func (binaryOption) Accept(cmd byte) bool {
+	return true
+}
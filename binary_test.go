@@ -0,0 +1,26 @@
+package gote
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinary(t *testing.T) {
+	tel := &conn{
+		i: bytes.NewBuffer(nil),
+		u: bytes.NewBuffer(nil),
+	}
+	// a mode already in effect isn't acknowledged again
+	tel.i.Write([]byte{IAC, WILL, BIN, IAC, WILL, BIN, IAC, DO, BIN, IAC, DO, BIN})
+	tel.parse()
+	assert.Equal(t, []byte{IAC, DO, BIN, IAC, WILL, BIN}, tel.replies)
+	assert.True(t, tel.remoteBinary())
+
+	tel.replies = nil
+	tel.i.Write([]byte{IAC, WONT, BIN, IAC, WONT, BIN, IAC, DONT, BIN})
+	tel.parse()
+	assert.Equal(t, []byte{IAC, DONT, BIN, IAC, WONT, BIN}, tel.replies)
+	assert.False(t, tel.remoteBinary())
+}
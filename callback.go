@@ -0,0 +1,59 @@
+package gote
+
+import "context"
+
+// call is a callback queued while parsing, and how many of the queued replies
+// go out before it.
+type call struct {
+	at int
+	fn func()
+}
+
+// later queues fn to run once the parsing pass is over and the uLock released,
+// so handlers can use the connection without deadlocking it.
+func (c *conn) later(fn func()) {
+	c.calls = append(c.calls, call{at: len(c.replies), fn: fn})
+}
+
+// callbacks runs the queued callbacks in order, each after the replies queued
+// before it was, so anything a handler sends still follows the agreement it
+// answers. The replies queued after the last one are left for flush.
+func (c *conn) callbacks() error {
+	var err error
+	sent := 0
+	for i, q := range c.calls {
+		c.calls[i] = call{}
+		if q.at > sent {
+			if e := c.send(c.replies[sent:q.at]); err == nil {
+				err = e
+			}
+			sent = q.at
+		}
+		q.fn()
+	}
+	c.calls = c.calls[:0]
+	c.replies = c.replies[:copy(c.replies, c.replies[sent:])]
+	return err
+}
+
+// handlerConn is the Connection given to option handlers. They run on the
+// processing goroutine, which Flush waits on, and by the time they run the
+// input before them has been processed and answered, so Flush has nothing to
+// wait for. What they send in answer is capped like negotiation replies.
+type handlerConn struct {
+	*conn
+}
+
+// SendRawSequence drops subnegotiation over the reply limit of its option, so
+// that a flood of requests isn't answered in full.
+func (h handlerConn) SendRawSequence(b ...byte) error {
+	if len(b) >= 3 && b[0] == IAC && b[1] == SB && !h.allow(b[2]) {
+		return nil
+	}
+	return h.conn.SendRawSequence(b...)
+}
+
+// Flush returns right away.
+func (h handlerConn) Flush(ctx context.Context) error {
+	return nil
+}
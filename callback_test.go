@@ -0,0 +1,63 @@
+package gote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+// readingOption uses the connection from every callback.
+type readingOption struct {
+	BaseOption
+	read chan string
+}
+
+func (o *readingOption) Accept(cmd byte) bool { return true }
+
+func (o *readingOption) Enabled(c Connection, cmd byte) {
+	o.use(c)
+}
+
+func (o *readingOption) Subnegotiation(c Connection, payload []byte) error {
+	o.use(c)
+	return nil
+}
+
+func (o *readingOption) use(c Connection) {
+	b := make([]byte, 16)
+	n, _ := c.TryRead(b)
+	c.ResourceStats()
+	c.Flush(context.Background())
+	o.read <- string(b[:n])
+}
+
+func TestCallbacks_UseConnection(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	o := &readingOption{read: make(chan string, 4)}
+	tel.RegisterOption(200, o)
+	tel.RegisterCommand(201, func(cmd byte) error {
+		b := make([]byte, 16)
+		n, _ := tel.TryRead(b)
+		o.read <- string(b[:n])
+		return nil
+	})
+	tel.start(client)
+	defer tel.Close()
+
+	_, err := server.Write([]byte{'a', IAC, DO, 200, 'b', IAC, 201, 'c', IAC, SB, 200, IAC, SE})
+	assert.NoError(t, err)
+	assert.NoError(t, server.Expect([]byte{IAC, WILL, 200}, time.Second))
+	// the callbacks run after the whole pass was parsed
+	for _, expected := range []string{"abc", "", ""} {
+		select {
+		case got := <-o.read:
+			assert.Equal(t, expected, got)
+		case <-time.After(time.Second):
+			t.Fatal("callback deadlocked")
+		}
+	}
+}
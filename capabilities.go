@@ -0,0 +1,103 @@
+package gote
+
+import (
+	"crypto/tls"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/morganhein/go-telnet/codec"
+)
+
+// Feature is something a connection can do, either because this version of the
+// package supports it or because it was negotiated with the peer.
+type Feature string
+
+// Features built into the package, supported by every connection.
+const (
+	// FeatureOptionHandlers means options can be negotiated by RegisterOption.
+	FeatureOptionHandlers Feature = "option-handlers"
+	// FeatureSubnegotiation means IAC SB sequences are parsed and dispatched.
+	FeatureSubnegotiation Feature = "subnegotiation"
+	// FeatureTimingMark means Ping and timing mark keepalives are available.
+	FeatureTimingMark Feature = "timing-mark"
+	// FeatureTerminalType means SetTerminalType is available.
+	FeatureTerminalType Feature = "terminal-type"
+	// FeatureEnviron means SetEnviron is available.
+	FeatureEnviron Feature = "environ"
+	// FeatureWindowSize means SetWindowSize is available.
+	FeatureWindowSize Feature = "window-size"
+)
+
+// Features that depend on the connection.
+const (
+	// FeatureServer is set on connections accepted by a Listener.
+	FeatureServer Feature = "server"
+	// FeatureTLS is set on connections running over TLS.
+	FeatureTLS Feature = "tls"
+	// FeatureRemoteEcho is set while the server echoes (option 1).
+	FeatureRemoteEcho Feature = "remote-echo"
+	// FeatureBinary is set while the peer sends binary data (option 0).
+	FeatureBinary Feature = "binary"
+)
+
+// OptionFeature returns the feature set while opt is on, on either side of the
+// connection, such as "option-naws". Every option that was agreed on is listed
+// this way, including those of handlers set with RegisterOption or RegisterPlugin.
+func OptionFeature(opt byte) Feature {
+	return Feature("option-" + strings.ToLower(codec.OptionName(opt)))
+}
+
+// builtin lists the features every connection has.
+var builtin = []Feature{FeatureEnviron, FeatureOptionHandlers, FeatureSubnegotiation, FeatureTerminalType, FeatureTimingMark, FeatureWindowSize}
+
+// Capabilities is the set of features of a connection, sorted.
+type Capabilities []Feature
+
+// Supports reports whether f is in the set.
+func (cs Capabilities) Supports(f Feature) bool {
+	for _, c := range cs {
+		if c == f {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities returns the features the connection has right now. Negotiated
+// features come and go as the peer changes its options.
+func (c *conn) Capabilities() Capabilities {
+	cs := append(Capabilities(nil), builtin...)
+	if c.server != nil {
+		cs = append(cs, FeatureServer)
+	}
+	if _, ok := c.Conn.(*tls.Conn); ok {
+		cs = append(cs, FeatureTLS)
+	}
+	if c.remoteBinary() {
+		cs = append(cs, FeatureBinary)
+	}
+	if c.RemoteEcho() {
+		cs = append(cs, FeatureRemoteEcho)
+	}
+	c.cLock.Lock()
+	for opt := range c.enabled {
+		cs = append(cs, OptionFeature(opt))
+	}
+	c.cLock.Unlock()
+	sort.Slice(cs, func(i, j int) bool { return cs[i] < cs[j] })
+	return cs
+}
+
+func (c *conn) setBinary(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&c.binary, v)
+}
+
+// remoteBinary reports whether the peer sends binary data.
+func (c *conn) remoteBinary() bool {
+	return atomic.LoadInt32(&c.binary) == 1
+}
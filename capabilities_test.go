@@ -0,0 +1,55 @@
+package gote
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilities(t *testing.T) {
+	tel := &conn{
+		i: bytes.NewBuffer(nil),
+		u: bytes.NewBuffer(nil),
+	}
+	cs := tel.Capabilities()
+	assert.Equal(t, Capabilities{FeatureEnviron, FeatureOptionHandlers, FeatureSubnegotiation, FeatureTerminalType, FeatureTimingMark, FeatureWindowSize}, cs)
+	assert.True(t, cs.Supports(FeatureSubnegotiation))
+	assert.False(t, cs.Supports(FeatureBinary))
+
+	tel.i.Write([]byte{IAC, WILL, BIN})
+	tel.parse()
+	assert.True(t, tel.Capabilities().Supports(FeatureBinary))
+	tel.i.Write([]byte{IAC, WONT, BIN})
+	tel.parse()
+	assert.False(t, tel.Capabilities().Supports(FeatureBinary))
+
+	tel.server = newServerState(nil, nil)
+	assert.True(t, tel.Capabilities().Supports(FeatureServer))
+}
+
+func TestCapabilities_Negotiated(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.SetWindowSize(80, 24)
+	tel.RegisterOption(200, policyOption{accept: true})
+	tel.start(client)
+	defer tel.Close()
+	assert.Equal(t, Feature("option-naws"), OptionFeature(NAWS))
+
+	err := server.Play(time.Second,
+		fake.Step{Send: []byte{IAC, DO, NAWS}, Expect: []byte{IAC, WILL, NAWS, IAC, SB, NAWS, 0, 80, 0, 24, IAC, SE}},
+		fake.Step{Send: []byte{IAC, WILL, 200}, Expect: []byte{IAC, DO, 200}},
+	)
+	assert.NoError(t, err)
+	cs := tel.Capabilities()
+	assert.True(t, cs.Supports(OptionFeature(NAWS)))
+	assert.True(t, cs.Supports(OptionFeature(200)))
+	assert.False(t, cs.Supports(OptionFeature(TTYPE)))
+
+	err = server.Play(time.Second, fake.Step{Send: []byte{IAC, DONT, NAWS}, Expect: []byte{IAC, WONT, NAWS}})
+	assert.NoError(t, err)
+	assert.False(t, tel.Capabilities().Supports(OptionFeature(NAWS)))
+}
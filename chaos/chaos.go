@@ -0,0 +1,181 @@
+// Package chaos wraps connections to misbehave in the ways real networks and devices
+// do: latency, arbitrary segmentation, negotiation replies in a different order and
+// sudden disconnects. It is meant for testing applications built on gote (go-telnet)
+// without a network harness. All randomness comes from Config.Seed, so a failing
+// run can be repeated.
+package chaos
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	gote "github.com/morganhein/go-telnet"
+	"github.com/morganhein/go-telnet/codec"
+)
+
+// ErrDisconnected is returned by the Read or Write that injected a disconnect.
+var ErrDisconnected = errors.New("chaos: injected disconnect")
+
+// Config says how a connection misbehaves. The zero Config changes nothing.
+type Config struct {
+	// Seed seeds the random choices.
+	Seed int64
+	// Latency is the longest random delay added before each Read and Write.
+	Latency time.Duration
+	// MaxSegment, if set, splits every Read and Write into random pieces of 1 to
+	// MaxSegment bytes. Each piece of a Write goes to the wrapped connection separately.
+	MaxSegment int
+	// Reorder shuffles the negotiation sequences found within each Write among
+	// themselves, leaving data and other commands in place. It only makes sense on
+	// raw telnet streams, see WrapConn.
+	Reorder bool
+	// Disconnect is the chance, from 0 to 1, of each Read and Write closing the
+	// connection and failing with ErrDisconnected instead.
+	Disconnect float64
+}
+
+// Conn is a net.Conn that misbehaves according to its Config.
+type Conn struct {
+	net.Conn
+	cfg Config
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// WrapConn wraps a raw connection, such as the server end of a fake.Pipe, so that
+// what the other end receives is delayed, split up and reordered.
+func WrapConn(c net.Conn, cfg Config) *Conn {
+	return &Conn{Conn: c, cfg: cfg, rnd: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// Read reads at most a random piece of b, after a random delay.
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.before(); err != nil {
+		return 0, err
+	}
+	if len(b) > 0 {
+		b = b[:c.segment(len(b))]
+	}
+	return c.Conn.Read(b)
+}
+
+// Write writes b in random pieces, each after a random delay. It returns how many
+// bytes of b were written.
+func (c *Conn) Write(b []byte) (int, error) {
+	if c.cfg.Reorder {
+		b = c.reorder(b)
+	}
+	sent := 0
+	for sent < len(b) || len(b) == 0 {
+		if err := c.before(); err != nil {
+			return sent, err
+		}
+		n, err := c.Conn.Write(b[sent : sent+c.segment(len(b)-sent)])
+		sent += n
+		if err != nil || len(b) == 0 {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// before sleeps for a random delay and maybe disconnects.
+func (c *Conn) before() error {
+	c.mu.Lock()
+	var d time.Duration
+	if c.cfg.Latency > 0 {
+		d = time.Duration(c.rnd.Int63n(int64(c.cfg.Latency) + 1))
+	}
+	drop := c.cfg.Disconnect > 0 && c.rnd.Float64() < c.cfg.Disconnect
+	c.mu.Unlock()
+	if drop {
+		c.Conn.Close()
+		return ErrDisconnected
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+	return nil
+}
+
+// segment returns a random piece size for n bytes.
+func (c *Conn) segment(n int) int {
+	if c.cfg.MaxSegment <= 0 || n <= 1 {
+		return n
+	}
+	max := c.cfg.MaxSegment
+	if max > n {
+		max = n
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return 1 + c.rnd.Intn(max)
+}
+
+// reorder shuffles the negotiation sequences in b. b is returned as is if it
+// doesn't parse as a complete telnet stream.
+func (c *Conn) reorder(b []byte) []byte {
+	var toks []codec.Token
+	var slots []int
+	t := codec.Tokenize(bytes.NewReader(b))
+	for {
+		tok, err := t.Next()
+		if err != nil {
+			if err != io.EOF {
+				return b
+			}
+			break
+		}
+		if tok.Kind == codec.Negotiation {
+			slots = append(slots, len(toks))
+		}
+		toks = append(toks, tok)
+	}
+	if len(slots) < 2 {
+		return b
+	}
+	c.mu.Lock()
+	perm := c.rnd.Perm(len(slots))
+	c.mu.Unlock()
+	raws := make([][]byte, len(toks))
+	for i, tok := range toks {
+		raws[i] = tok.Raw
+	}
+	for i, p := range perm {
+		raws[slots[i]] = toks[slots[p]].Raw
+	}
+	return bytes.Join(raws, nil)
+}
+
+// Wrap wraps a Connection so that its Reads, ReadEvents and Writes are delayed,
+// split up and disconnected at random. Reorder has no effect here, as a Connection only carries
+// data; wrap the raw connection with WrapConn for that.
+func Wrap(c gote.Connection, cfg Config) gote.Connection {
+	cfg.Reorder = false
+	return &connection{Connection: c, chaos: WrapConn(c, cfg)}
+}
+
+type connection struct {
+	gote.Connection
+	chaos *Conn
+}
+
+func (c *connection) Read(b []byte) (int, error)  { return c.chaos.Read(b) }
+func (c *connection) Write(b []byte) (int, error) { return c.chaos.Write(b) }
+
+// ReadEvent reads at most a random piece of b, after a random delay, like Read.
+func (c *connection) ReadEvent(b []byte) (int, *gote.Event, error) {
+	if err := c.chaos.before(); err != nil {
+		return 0, nil, err
+	}
+	if len(b) > 0 {
+		b = b[:c.chaos.segment(len(b))]
+	}
+	return c.Connection.ReadEvent(b)
+}
@@ -0,0 +1,106 @@
+package chaos
+
+import (
+	"io"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	gote "github.com/morganhein/go-telnet"
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConn_Segmentation(t *testing.T) {
+	client, server := fake.Pipe()
+	c := WrapConn(server, Config{Seed: 1, MaxSegment: 3})
+	payload := []byte("segmented into random pieces")
+	n, err := c.Write(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, len(payload), n)
+
+	// every piece arrives as its own segment
+	var got []byte
+	b := make([]byte, 100)
+	for len(got) < len(payload) {
+		n, err := client.Read(b)
+		if !assert.NoError(t, err) {
+			break
+		}
+		assert.True(t, n <= 3)
+		got = append(got, b[:n]...)
+	}
+	assert.Equal(t, payload, got)
+}
+
+func TestConn_Reorder(t *testing.T) {
+	client, server := fake.Pipe()
+	c := WrapConn(server, Config{Seed: 3, Reorder: true})
+	stream := []byte{'a', 255, 251, 1, 255, 251, 3, 'b', 255, 253, 24, 255, 241}
+	c.Write(stream)
+
+	got := make([]byte, len(stream))
+	_, err := io.ReadFull(client, got)
+	assert.NoError(t, err)
+	assert.NotEqual(t, stream, got)
+	// data and other commands stay where they were
+	assert.Equal(t, byte('a'), got[0])
+	assert.Equal(t, byte('b'), got[7])
+	assert.Equal(t, []byte{255, 241}, got[11:])
+	negotiations := []string{string(got[1:4]), string(got[4:7]), string(got[8:11])}
+	sort.Strings(negotiations)
+	assert.Equal(t, []string{"\xff\xfb\x01", "\xff\xfb\x03", "\xff\xfd\x18"}, negotiations)
+}
+
+func TestConn_Disconnect(t *testing.T) {
+	client, server := fake.Pipe()
+	c := WrapConn(client, Config{Disconnect: 1})
+	_, err := c.Read(make([]byte, 1))
+	assert.Equal(t, ErrDisconnected, err)
+	_, err = server.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestWrap(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		s, err := l.Accept()
+		if err != nil {
+			return
+		}
+		s.Write([]byte("hello"))
+		accepted <- s
+	}()
+	tel, err := gote.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Wrap(tel, Config{Seed: 2, MaxSegment: 2, Latency: time.Millisecond})
+	defer c.Close()
+	b := make([]byte, 5)
+	_, err = gote.ReadFull(c, b)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+
+	// ReadEvent is split up the same way
+	s := <-accepted
+	defer s.Close()
+	s.Write([]byte("again"))
+	var got []byte
+	for len(got) < 5 {
+		n, ev, err := c.ReadEvent(b)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Nil(t, ev)
+		assert.True(t, n <= 2)
+		got = append(got, b[:n]...)
+	}
+	assert.Equal(t, "again", string(got))
+}
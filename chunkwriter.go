@@ -0,0 +1,122 @@
+package gote
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// defaultChunkSize is the chunk size of a ChunkWriter without one set.
+const defaultChunkSize = 4096
+
+// ChunkWriter writes large payloads, such as config pushes or file transfers, to a
+// connection in chunks, each with its own write deadline, reporting progress as it goes.
+type ChunkWriter struct {
+	// Size is the most bytes written in one chunk. Zero means 4096.
+	Size int
+	// Timeout is the write deadline given to each chunk. Zero means no deadline.
+	Timeout time.Duration
+	// Progress, if set, is called after every chunk with the number of bytes of the
+	// payload sent so far and its total size.
+	Progress func(sent, total int)
+
+	c net.Conn
+}
+
+// NewChunkWriter returns a ChunkWriter writing to c, usually a Connection.
+func NewChunkWriter(c net.Conn) *ChunkWriter {
+	return &ChunkWriter{c: c}
+}
+
+// Write writes b in chunks. It returns the number of bytes of b sent before any error.
+func (w *ChunkWriter) Write(b []byte) (int, error) {
+	return w.WriteContext(context.Background(), b)
+}
+
+// WriteContext writes b in chunks, stopping once ctx is done and returning its error
+// along with the number of bytes sent. A chunk being written when ctx is done is cut
+// short by moving the write deadline to now, so how much of it went out is unknown.
+// The write deadline is cleared when it returns, if Timeout is set or ctx was done.
+func (w *ChunkWriter) WriteContext(ctx context.Context, b []byte) (int, error) {
+	size := w.Size
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	d := &chunkDeadline{c: w.c}
+	// runs last, once the goroutine below can't move the deadline anymore
+	defer func() {
+		if w.Timeout > 0 || d.cancelled {
+			w.c.SetWriteDeadline(time.Time{})
+		}
+	}()
+	if ctx.Done() != nil {
+		stop, exited := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(exited)
+			select {
+			case <-ctx.Done():
+				d.cancel()
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-exited
+		}()
+	}
+	sent := 0
+	for sent < len(b) {
+		select {
+		case <-ctx.Done():
+			return sent, ctx.Err()
+		default:
+		}
+		end := sent + size
+		if end >= len(b) {
+			end = len(b)
+		} else if b[end-1] == '\r' {
+			// keep CR LF together, so newline translation sees the pair
+			end++
+		}
+		if w.Timeout > 0 {
+			d.set(time.Now().Add(w.Timeout))
+		}
+		n, err := w.c.Write(b[sent:end])
+		sent += n
+		if err != nil {
+			if ctx.Err() != nil {
+				return sent, ctx.Err()
+			}
+			return sent, err
+		}
+		if w.Progress != nil {
+			w.Progress(sent, len(b))
+		}
+	}
+	return sent, nil
+}
+
+// chunkDeadline sets the write deadline for a WriteContext, which once cancelled
+// stays in the past.
+type chunkDeadline struct {
+	c         net.Conn
+	mu        sync.Mutex
+	cancelled bool
+}
+
+func (d *chunkDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.cancelled {
+		d.c.SetWriteDeadline(t)
+	}
+}
+
+// cancel interrupts the write in progress, if any.
+func (d *chunkDeadline) cancel() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cancelled = true
+	d.c.SetWriteDeadline(time.Now())
+}
@@ -0,0 +1,72 @@
+package gote
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkWriter(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{Conn: client}
+	tel.SetTranslateNewlines(true)
+
+	w := NewChunkWriter(tel)
+	w.Size = 3
+	w.Timeout = time.Second
+	var progress []int
+	w.Progress = func(sent, total int) {
+		assert.Equal(t, 8, total)
+		progress = append(progress, sent)
+	}
+	n, err := w.Write([]byte("ab\r\ncd\xffe"))
+	assert.NoError(t, err)
+	assert.Equal(t, 8, n)
+	assert.Equal(t, []int{4, 7, 8}, progress)
+	assert.NoError(t, server.Expect([]byte("ab\r\ncd\xff\xffe"), time.Second))
+}
+
+func TestChunkWriter_Cancel(t *testing.T) {
+	client, server := fake.Pipe()
+	w := NewChunkWriter(client)
+	w.Size = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	w.Progress = func(sent, total int) {
+		cancel()
+	}
+	n, err := w.WriteContext(ctx, []byte("abcdef"))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 2, n)
+	assert.NoError(t, server.Expect([]byte("ab"), time.Second))
+}
+
+func TestChunkWriter_Deadline(t *testing.T) {
+	client, _ := fake.Pipe()
+	w := NewChunkWriter(client)
+	w.Timeout = time.Nanosecond
+	_, err := w.Write([]byte("abc"))
+	assert.Error(t, err)
+}
+
+func TestChunkWriter_CancelBlocked(t *testing.T) {
+	// nobody reads, so the first write blocks
+	client, server := net.Pipe()
+	defer server.Close()
+	w := NewChunkWriter(client)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Duration(50)*time.Millisecond, cancel)
+	start := time.Now()
+	n, err := w.WriteContext(ctx, []byte("abcdef"))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, n)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// the deadline is cleared afterwards
+	go server.Read(make([]byte, 1))
+	_, err = client.Write([]byte("x"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,119 @@
+// Command gote-decode annotates a telnet stream with its telnet semantics, one line per token.
+//
+// Input is read from the named file, or standard input, as a hex dump. Whitespace between
+// hex digits is ignored, as are offsets ending in a colon and the text column of xxd style
+// dumps (anything after two consecutive spaces). Use -raw for binary captures.
+//
+//	gote-decode capture.hex
+//	gote-decode -raw capture.bin
+//
+// With -peer, the input is the client side of a captured session and the named file
+// the server side, in the same format. Both are decoded, each line prefixed with the
+// side that sent it, followed by the options each side ended up with.
+//
+//	gote-decode -peer server.hex client.hex
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/morganhein/go-telnet/codec"
+)
+
+// maxRaw is the number of raw bytes shown per line.
+const maxRaw = 8
+
+func main() {
+	raw := flag.Bool("raw", false, "read a binary capture instead of a hex dump")
+	peer := flag.String("peer", "", "decode a session, with this file as the server side")
+	flag.Parse()
+
+	in := io.Reader(os.Stdin)
+	if flag.NArg() > 0 {
+		in = open(flag.Arg(0))
+	}
+	in = load(in, *raw)
+	var err error
+	if *peer != "" {
+		err = decodeSession(os.Stdout, in, load(open(*peer), *raw))
+	} else {
+		err = decode(os.Stdout, in)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func open(name string) io.Reader {
+	f, err := os.Open(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return f
+}
+
+// load reads in as a hex dump unless raw is set.
+func load(in io.Reader, raw bool) io.Reader {
+	if raw {
+		return in
+	}
+	b, err := codec.ParseHexDump(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return bytes.NewReader(b)
+}
+
+// decode writes one annotated line for every token in r.
+func decode(w io.Writer, r io.Reader) error {
+	t := codec.Tokenize(r)
+	for {
+		tok, err := t.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("offset %08x: %v", tok.Offset, err)
+		}
+		fmt.Fprintf(w, "%08x  %-26s %s\n", tok.Offset, rawHex(tok.Raw), tok)
+	}
+}
+
+// decodeSession writes the annotated tokens of both sides of a session, then the
+// options each side had enabled at the end.
+func decodeSession(w io.Writer, client, server io.Reader) error {
+	tr, err := codec.DecodeSession(client, server)
+	for d, toks := range tr.Tokens {
+		for _, tok := range toks {
+			fmt.Fprintf(w, "%-6s %08x  %-26s %s\n", codec.Direction(d), tok.Offset, rawHex(tok.Raw), tok)
+		}
+	}
+	for d, opts := range tr.Enabled {
+		names := make([]string, len(opts))
+		for i, opt := range opts {
+			names[i] = codec.OptionName(opt)
+		}
+		fmt.Fprintf(w, "%s enabled: %s\n", codec.Direction(d), strings.Join(names, " "))
+	}
+	return err
+}
+
+func rawHex(b []byte) string {
+	parts := make([]string, 0, maxRaw+1)
+	for i, c := range b {
+		if i == maxRaw {
+			parts = append(parts, "..")
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%02x", c))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	var out bytes.Buffer
+	err := decode(&out, bytes.NewReader([]byte{255, 253, 24, 'h', 'i'}))
+	assert.NoError(t, err)
+	assert.Equal(t, "00000000  ff fd 18                   IAC DO TTYPE\n"+
+		"00000003  68 69                      data \"hi\"\n", out.String())
+}
+
+func TestDecodeSession(t *testing.T) {
+	var out bytes.Buffer
+	err := decodeSession(&out, bytes.NewReader([]byte{255, 251, 24, 'a'}), bytes.NewReader([]byte{255, 253, 24}))
+	assert.NoError(t, err)
+	assert.Equal(t, "client 00000000  ff fb 18                   IAC WILL TTYPE\n"+
+		"client 00000003  61                         data \"a\"\n"+
+		"server 00000000  ff fd 18                   IAC DO TTYPE\n"+
+		"client enabled: TTYPE\n"+
+		"server enabled: \n", out.String())
+}
@@ -0,0 +1,128 @@
+// Command gote-lint reports RFC violations in what a telnet server sends: malformed
+// or unknown commands, negotiation loops, bare CRs in NVT text, and subnegotiation
+// for options that were never negotiated.
+//
+// Given an address, it connects, refuses every option the server asks for, and checks
+// everything received for the listening period. This shows how the server copes with
+// unsupported options, since servers that don't take no for an answer show up as loops.
+// A command still arriving when the period ends is left out rather than reported.
+// With -f it checks a capture of the server's side of a session instead, as a hex dump,
+// or as binary with -raw.
+//
+//	gote-lint -t 10s router.example.com:23
+//	gote-lint -f capture.hex
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/morganhein/go-telnet/codec"
+)
+
+func main() {
+	file := flag.String("f", "", "check a capture file instead of connecting")
+	raw := flag.Bool("raw", false, "the capture is binary instead of a hex dump")
+	wait := flag.Duration("t", 5*time.Second, "how long to listen to the server")
+	flag.Parse()
+
+	var stream []byte
+	var cut int
+	var err error
+	switch {
+	case *file != "":
+		stream, err = readCapture(*file, *raw)
+	case flag.NArg() == 1:
+		stream, cut, err = capture(flag.Arg(0), *wait)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: gote-lint [-t duration] host:port | gote-lint [-raw] -f capture")
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	problems, err := codec.Validate(bytes.NewReader(stream))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	report(os.Stdout, len(stream), cut, problems)
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+func readCapture(name string, raw bool) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if raw {
+		var b bytes.Buffer
+		_, err = b.ReadFrom(f)
+		return b.Bytes(), err
+	}
+	return codec.ParseHexDump(f)
+}
+
+// capture connects to address and records what the server sends for the given
+// period, refusing every option it negotiates.
+func capture(address string, wait time.Duration) ([]byte, int, error) {
+	c, err := net.DialTimeout("tcp", address, wait)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(wait))
+	return refuseAll(c)
+}
+
+// refuseAll answers every WILL with DONT and every DO with WONT, until reading fails.
+// It returns everything read. When reading stops on the deadline in the middle of a
+// command, the rest of the command may just not have arrived yet, so what was read
+// of it is left out, and cut says how many bytes that was.
+func refuseAll(c io.ReadWriter) (stream []byte, cut int, err error) {
+	var b bytes.Buffer
+	t := codec.Tokenize(io.TeeReader(c, &b))
+	end := 0 // of the last complete token
+	for {
+		tok, err := t.Next()
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				return b.Bytes()[:end], b.Len() - end, nil
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = nil
+			}
+			return b.Bytes(), 0, err
+		}
+		end = int(tok.Offset) + len(tok.Raw)
+		if tok.Kind != codec.Negotiation {
+			continue
+		}
+		switch tok.Cmd {
+		case 251: // WILL
+			c.Write([]byte{255, 254, tok.Opt})
+		case 253: // DO
+			c.Write([]byte{255, 252, tok.Opt})
+		}
+	}
+}
+
+func report(w io.Writer, n, cut int, problems []codec.Problem) {
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	if cut > 0 {
+		fmt.Fprintf(w, "listening stopped in the middle of a command, its first %d bytes weren't checked\n", cut)
+	}
+	fmt.Fprintf(w, "%d bytes checked, %d problems\n", n, len(problems))
+}
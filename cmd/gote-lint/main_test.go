@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefuseAll(t *testing.T) {
+	client, server := fake.Pipe()
+	go func() {
+		server.Write([]byte{255, 253, 24, 255, 251, 1, 'h', 'i'})
+		server.Expect([]byte{255, 252, 24, 255, 254, 1}, time.Second)
+		server.Close()
+	}()
+	stream, cut, err := refuseAll(client)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cut)
+	assert.Equal(t, []byte{255, 253, 24, 255, 251, 1, 'h', 'i'}, stream)
+}
+
+func TestRefuseAll_Deadline(t *testing.T) {
+	client, server := fake.Pipe()
+	// the rest of the subnegotiation hasn't arrived when listening stops
+	server.Write([]byte{'h', 'i', 255, 250, 24, 0})
+	client.SetReadDeadline(time.Now().Add(time.Duration(100) * time.Millisecond))
+	stream, cut, err := refuseAll(client)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, cut)
+	assert.Equal(t, []byte("hi"), stream)
+}
+
+func TestReport(t *testing.T) {
+	var out bytes.Buffer
+	report(&out, 10, 0, nil)
+	assert.Equal(t, "10 bytes checked, 0 problems\n", out.String())
+	out.Reset()
+	report(&out, 10, 3, nil)
+	assert.Equal(t, "listening stopped in the middle of a command, its first 3 bytes weren't checked\n10 bytes checked, 0 problems\n", out.String())
+}
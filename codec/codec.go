@@ -0,0 +1,228 @@
+// Package codec splits a raw telnet byte stream into typed tokens. It works on any
+// io.Reader, so it can be used offline on captured streams as well as on live connections.
+package codec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	iac  = 255
+	dont = 254
+	do   = 253
+	wont = 252
+	will = 251
+	sb   = 250
+	se   = 240
+)
+
+// maxData is the largest Data token returned. Longer runs are split up.
+const maxData = 4096
+
+// Kind is the type of a token.
+type Kind int
+
+const (
+	// Data is application data, with escaped IAC bytes already decoded.
+	Data Kind = iota
+	// Command is a two byte IAC <cmd> sequence, such as IAC NOP or IAC AYT.
+	Command
+	// Negotiation is an IAC WILL/WONT/DO/DONT <opt> sequence.
+	Negotiation
+	// Subnegotiation is an IAC SB <opt> ... IAC SE sequence.
+	Subnegotiation
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Data:
+		return "data"
+	case Command:
+		return "command"
+	case Negotiation:
+		return "negotiation"
+	case Subnegotiation:
+		return "subnegotiation"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Token is a single element of a telnet stream.
+type Token struct {
+	Kind Kind
+	// Offset is the position of the first raw byte of the token in the stream.
+	Offset int64
+	// Raw holds the bytes exactly as they appeared in the stream.
+	Raw []byte
+	// Cmd is the command byte of Command and Negotiation tokens, and SB for Subnegotiation.
+	Cmd byte
+	// Opt is the option of Negotiation and Subnegotiation tokens.
+	Opt byte
+	// Data is the decoded data of Data tokens, and the unescaped payload
+	// (without the option byte) of Subnegotiation tokens.
+	Data []byte
+	// Unterminated is set on a Subnegotiation that was cut short by an IAC followed
+	// by something other than SE or IAC. The stream continues at that IAC.
+	Unterminated bool
+}
+
+func (t Token) String() string {
+	switch t.Kind {
+	case Data:
+		return fmt.Sprintf("data %q", t.Data)
+	case Command:
+		return "IAC " + CommandName(t.Cmd)
+	case Negotiation:
+		return fmt.Sprintf("IAC %s %s", CommandName(t.Cmd), OptionName(t.Opt))
+	case Subnegotiation:
+		parts := []string{"IAC SB", OptionName(t.Opt)}
+		for _, b := range t.Data {
+			parts = append(parts, fmt.Sprintf("%02x", b))
+		}
+		if t.Unterminated {
+			parts = append(parts, "(unterminated)")
+		} else {
+			parts = append(parts, "IAC SE")
+		}
+		return strings.Join(parts, " ")
+	}
+	return t.Kind.String()
+}
+
+// Tokenizer reads tokens from a stream.
+type Tokenizer struct {
+	r      *bufio.Reader
+	offset int64
+}
+
+// Tokenize returns a Tokenizer reading from r.
+func Tokenize(r io.Reader) *Tokenizer {
+	return &Tokenizer{r: bufio.NewReader(r)}
+}
+
+// Next returns the next token. At the end of the stream it returns io.EOF, or
+// io.ErrUnexpectedEOF if the stream ends in the middle of a sequence.
+// A Data token never waits for more input once some data has been read, so
+// on a live connection it holds whatever had arrived.
+func (t *Tokenizer) Next() (Token, error) {
+	tok := Token{Offset: t.offset}
+	b, err := t.readByte(&tok)
+	if err != nil {
+		return tok, err
+	}
+	if b != iac {
+		return t.data(tok, b)
+	}
+	cmd, err := t.readByte(&tok)
+	if err != nil {
+		return tok, unexpected(err)
+	}
+	switch cmd {
+	case iac:
+		return t.data(tok, iac)
+	case will, wont, do, dont:
+		opt, err := t.readByte(&tok)
+		if err != nil {
+			return tok, unexpected(err)
+		}
+		tok.Kind, tok.Cmd, tok.Opt = Negotiation, cmd, opt
+		return tok, nil
+	case sb:
+		return t.subnegotiation(tok)
+	}
+	tok.Kind, tok.Cmd = Command, cmd
+	return tok, nil
+}
+
+// data reads a run of data bytes, starting with first.
+func (t *Tokenizer) data(tok Token, first byte) (Token, error) {
+	tok.Kind = Data
+	tok.Data = append(tok.Data, first)
+	for len(tok.Data) < maxData && t.r.Buffered() > 0 {
+		p, _ := t.r.Peek(1)
+		if p[0] != iac {
+			t.r.ReadByte()
+			tok.Raw = append(tok.Raw, p[0])
+			t.offset++
+			tok.Data = append(tok.Data, p[0])
+			continue
+		}
+		// only an escaped IAC continues the data run
+		if t.r.Buffered() < 2 {
+			break
+		}
+		p, _ = t.r.Peek(2)
+		if p[1] != iac {
+			break
+		}
+		t.r.Discard(2)
+		tok.Raw = append(tok.Raw, iac, iac)
+		t.offset += 2
+		tok.Data = append(tok.Data, iac)
+	}
+	return tok, nil
+}
+
+// subnegotiation reads the remainder of an IAC SB sequence.
+func (t *Tokenizer) subnegotiation(tok Token) (Token, error) {
+	tok.Kind, tok.Cmd = Subnegotiation, sb
+	opt, err := t.readByte(&tok)
+	if err != nil {
+		return tok, unexpected(err)
+	}
+	tok.Opt = opt
+	tok.Data = []byte{}
+	for {
+		p, err := t.r.Peek(1)
+		if err != nil {
+			return tok, unexpected(err)
+		}
+		if p[0] != iac {
+			t.r.ReadByte()
+			tok.Raw = append(tok.Raw, p[0])
+			t.offset++
+			tok.Data = append(tok.Data, p[0])
+			continue
+		}
+		p, err = t.r.Peek(2)
+		if err != nil {
+			return tok, unexpected(err)
+		}
+		switch p[1] {
+		case iac:
+			t.r.Discard(2)
+			tok.Raw = append(tok.Raw, iac, iac)
+			t.offset += 2
+			tok.Data = append(tok.Data, iac)
+		case se:
+			t.r.Discard(2)
+			tok.Raw = append(tok.Raw, iac, se)
+			t.offset += 2
+			return tok, nil
+		default:
+			// leave the IAC to start the next token
+			tok.Unterminated = true
+			return tok, nil
+		}
+	}
+}
+
+func (t *Tokenizer) readByte(tok *Token) (byte, error) {
+	b, err := t.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	tok.Raw = append(tok.Raw, b)
+	t.offset++
+	return b, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tokenize(t *testing.T, b []byte) ([]Token, error) {
+	var toks []Token
+	tz := Tokenize(bytes.NewReader(b))
+	for {
+		tok, err := tz.Next()
+		if err != nil {
+			return toks, err
+		}
+		toks = append(toks, tok)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	stream := []byte{'h', 'i', 255, 255, '!', 255, 253, 24, 255, 241, 255, 250, 24, 1, 255, 255, 255, 240, 'x'}
+	toks, err := tokenize(t, stream)
+	assert.Equal(t, io.EOF, err)
+	assert.Len(t, toks, 5)
+
+	assert.Equal(t, Data, toks[0].Kind)
+	assert.Equal(t, []byte{'h', 'i', 255, '!'}, toks[0].Data)
+	assert.Equal(t, []byte{'h', 'i', 255, 255, '!'}, toks[0].Raw)
+
+	assert.Equal(t, Negotiation, toks[1].Kind)
+	assert.Equal(t, int64(5), toks[1].Offset)
+	assert.Equal(t, "IAC DO TTYPE", toks[1].String())
+
+	assert.Equal(t, Command, toks[2].Kind)
+	assert.Equal(t, "IAC NOP", toks[2].String())
+
+	assert.Equal(t, Subnegotiation, toks[3].Kind)
+	assert.Equal(t, int64(10), toks[3].Offset)
+	assert.Equal(t, byte(24), toks[3].Opt)
+	assert.Equal(t, []byte{1, 255}, toks[3].Data)
+	assert.False(t, toks[3].Unterminated)
+
+	assert.Equal(t, int64(18), toks[4].Offset)
+	assert.Equal(t, []byte{'x'}, toks[4].Data)
+
+	// raw bytes of all tokens add back up to the stream
+	var raw []byte
+	for _, tok := range toks {
+		raw = append(raw, tok.Raw...)
+	}
+	assert.Equal(t, stream, raw)
+}
+
+func TestTokenize_Unterminated(t *testing.T) {
+	toks, err := tokenize(t, []byte{255, 250, 31, 0, 80, 255, 253, 1})
+	assert.Equal(t, io.EOF, err)
+	assert.Len(t, toks, 2)
+	assert.True(t, toks[0].Unterminated)
+	assert.Equal(t, []byte{0, 80}, toks[0].Data)
+	assert.Equal(t, "IAC DO ECHO", toks[1].String())
+}
+
+func TestTokenize_Truncated(t *testing.T) {
+	for _, b := range [][]byte{{255}, {255, 251}, {255, 250, 24, 1}, {255, 250, 24, 255}} {
+		_, err := tokenize(t, b)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	}
+}
@@ -0,0 +1,25 @@
+package codec_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/morganhein/go-telnet/codec"
+)
+
+func ExampleTokenize() {
+	stream := []byte("\xff\xfb\x01login: \xff\xfa\x18\x01\xff\xf0")
+	t := codec.Tokenize(bytes.NewReader(stream))
+	for {
+		tok, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+		fmt.Println(tok)
+	}
+	// Output:
+	// IAC WILL ECHO
+	// data "login: "
+	// IAC SB TTYPE 01 IAC SE
+}
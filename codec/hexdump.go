@@ -0,0 +1,47 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseHexDump reads a hex dump of a stream. Whitespace between hex digits is ignored,
+// as are offsets ending in a colon and the text column of xxd style dumps
+// (anything after two consecutive spaces).
+func ParseHexDump(r io.Reader) ([]byte, error) {
+	var digits []byte
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line++
+		l := s.Text()
+		if i := strings.Index(l, ":"); i != -1 {
+			l = l[i+1:]
+		}
+		l = strings.TrimLeft(l, " \t")
+		if i := strings.Index(l, "  "); i != -1 {
+			l = l[:i]
+		}
+		for _, c := range l {
+			if c == ' ' || c == '\t' {
+				continue
+			}
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return nil, fmt.Errorf("line %d: unexpected %q in hex dump", line, c)
+			}
+			digits = append(digits, byte(c))
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(digits)%2 != 0 {
+		return nil, fmt.Errorf("hex dump has an odd number of digits")
+	}
+	b := make([]byte, len(digits)/2)
+	_, err := hex.Decode(b, digits)
+	return b, err
+}
@@ -0,0 +1,23 @@
+package codec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHexDump(t *testing.T) {
+	b, err := ParseHexDump(strings.NewReader("fffd18 ff\nfb01"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{255, 253, 24, 255, 251, 1}, b)
+
+	b, err = ParseHexDump(strings.NewReader("00000000: fffd 1868 69                             ...hi\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{255, 253, 24, 'h', 'i'}, b)
+
+	_, err = ParseHexDump(strings.NewReader("fffg"))
+	assert.Error(t, err)
+	_, err = ParseHexDump(strings.NewReader("fff"))
+	assert.Error(t, err)
+}
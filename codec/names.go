@@ -0,0 +1,68 @@
+package codec
+
+import "strconv"
+
+var commandNames = map[byte]string{
+	236: "EOF",
+	237: "SUSP",
+	238: "ABORT",
+	239: "EOR",
+	240: "SE",
+	241: "NOP",
+	242: "DM",
+	243: "BRK",
+	244: "IP",
+	245: "AO",
+	246: "AYT",
+	247: "EC",
+	248: "EL",
+	249: "GA",
+	250: "SB",
+	251: "WILL",
+	252: "WONT",
+	253: "DO",
+	254: "DONT",
+	255: "IAC",
+}
+
+var optionNames = map[byte]string{
+	0:   "BINARY",
+	1:   "ECHO",
+	2:   "RECONNECT",
+	3:   "SGA",
+	5:   "STATUS",
+	6:   "TIMING-MARK",
+	18:  "LOGOUT",
+	24:  "TTYPE",
+	25:  "EOR",
+	31:  "NAWS",
+	32:  "TSPEED",
+	33:  "LFLOW",
+	34:  "LINEMODE",
+	35:  "XDISPLOC",
+	36:  "ENVIRON",
+	37:  "AUTHENTICATION",
+	38:  "ENCRYPT",
+	39:  "NEW-ENVIRON",
+	42:  "CHARSET",
+	44:  "COM-PORT",
+	86:  "MCCP2",
+	201: "GMCP",
+	255: "EXOPL",
+}
+
+// CommandName returns the name of a telnet command byte, or its decimal value if unknown.
+func CommandName(b byte) string {
+	if n, ok := commandNames[b]; ok {
+		return n
+	}
+	return strconv.Itoa(int(b))
+}
+
+// OptionName returns the name of a telnet option, or its decimal value if unknown.
+func OptionName(b byte) string {
+	if n, ok := optionNames[b]; ok {
+		return n
+	}
+	return strconv.Itoa(int(b))
+}
@@ -0,0 +1,100 @@
+package codec
+
+import (
+	"fmt"
+	"io"
+)
+
+// Direction is the side of a captured session that sent a stream.
+type Direction int
+
+const (
+	// Client is the side that opened the connection.
+	Client Direction = iota
+	// Server is the side that accepted it.
+	Server
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Client:
+		return "client"
+	case Server:
+		return "server"
+	}
+	return fmt.Sprintf("Direction(%d)", int(d))
+}
+
+// Transcript is a captured session between two other parties, decoded per direction.
+// Arrays are indexed by Direction.
+type Transcript struct {
+	// Text is the data sent by each side, with all telnet sequences removed.
+	Text [2][]byte
+	// Tokens are all the tokens sent by each side, in stream order.
+	Tokens [2][]Token
+	// Enabled lists, in order of first mention, the options each side had in effect
+	// at the end of the capture: it offered them with WILL and the other side
+	// agreed with DO, and neither took it back later.
+	Enabled [2][]byte
+}
+
+// DecodeSession decodes both directions of a captured session. The streams carry no
+// timing, so the directions are decoded independently and negotiations are matched
+// up by their final state only. A capture that is cut off in the middle of a
+// sequence returns what was decoded along with the error.
+func DecodeSession(client, server io.Reader) (*Transcript, error) {
+	tr := &Transcript{}
+	var firstErr error
+	for d, r := range [2]io.Reader{client, server} {
+		t := Tokenize(r)
+		for {
+			tok, err := t.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s offset %08x: %v", Direction(d), tok.Offset, err)
+				}
+				break
+			}
+			tr.Tokens[d] = append(tr.Tokens[d], tok)
+			if tok.Kind == Data {
+				tr.Text[d] = append(tr.Text[d], tok.Data...)
+			}
+		}
+	}
+	tr.Enabled[Client] = enabled(tr.Tokens[Client], tr.Tokens[Server])
+	tr.Enabled[Server] = enabled(tr.Tokens[Server], tr.Tokens[Client])
+	return tr, firstErr
+}
+
+// enabled returns the options offered in side and agreed to in peer.
+func enabled(side, peer []Token) []byte {
+	offered, order := lastNegotiation(side, will, wont)
+	agreed, _ := lastNegotiation(peer, do, dont)
+	var opts []byte
+	for _, opt := range order {
+		if offered[opt] && agreed[opt] {
+			opts = append(opts, opt)
+		}
+	}
+	return opts
+}
+
+// lastNegotiation returns whether the last yes or no negotiation for each option
+// was a yes, and the options in order of first mention.
+func lastNegotiation(toks []Token, yes, no byte) (map[byte]bool, []byte) {
+	last := make(map[byte]bool)
+	var order []byte
+	for _, tok := range toks {
+		if tok.Kind != Negotiation || (tok.Cmd != yes && tok.Cmd != no) {
+			continue
+		}
+		if _, ok := last[tok.Opt]; !ok {
+			order = append(order, tok.Opt)
+		}
+		last[tok.Opt] = tok.Cmd == yes
+	}
+	return last, order
+}
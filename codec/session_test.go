@@ -0,0 +1,40 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeSession(t *testing.T) {
+	client := []byte{iac, will, 24, iac, will, 31, iac, do, 3, 'l', 's', '\r', '\n', iac, wont, 31}
+	server := []byte{iac, do, 24, iac, do, 31, iac, will, 3, iac, will, 1, 'l', 'o', 'g', 'i', 'n', iac, iac}
+	tr, err := DecodeSession(bytes.NewReader(client), bytes.NewReader(server))
+	assert.NoError(t, err)
+	assert.Equal(t, "ls\r\n", string(tr.Text[Client]))
+	assert.Equal(t, []byte("login\xff"), tr.Text[Server])
+	assert.Len(t, tr.Tokens[Client], 5)
+	assert.Len(t, tr.Tokens[Server], 5)
+
+	// NAWS was withdrawn, and the client never agreed to ECHO
+	assert.Equal(t, []byte{24}, tr.Enabled[Client])
+	assert.Equal(t, []byte{3}, tr.Enabled[Server])
+}
+
+func TestDecodeSession_Truncated(t *testing.T) {
+	tr, err := DecodeSession(bytes.NewReader([]byte{'a', iac}), bytes.NewReader([]byte{'b'}))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "client offset 00000001")
+	assert.Contains(t, err.Error(), io.ErrUnexpectedEOF.Error())
+	// both directions are still decoded
+	assert.Equal(t, "a", string(tr.Text[Client]))
+	assert.Equal(t, "b", string(tr.Text[Server]))
+}
+
+func TestDirection_String(t *testing.T) {
+	assert.Equal(t, "client", Client.String())
+	assert.Equal(t, "server", Server.String())
+	assert.Equal(t, "Direction(5)", Direction(5).String())
+}
@@ -0,0 +1,138 @@
+package codec
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// maxRepeats is how many times the same negotiation may appear in a stream before
+// the Validator reports it as a negotiation loop.
+const maxRepeats = 3
+
+// Problem is a protocol violation found in a stream.
+type Problem struct {
+	// Offset is the position of the offending token in the stream.
+	Offset int64
+	Msg    string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%08x: %s", p.Offset, p.Msg)
+}
+
+// Validator checks the tokens of one direction of a telnet stream against RFC 854
+// and friends, strictly: anything a lenient peer would merely tolerate is reported.
+type Validator struct {
+	negotiated map[byte]bool // options offered or requested with WILL or DO
+	binary     bool          // WILL BINARY was seen, so data is no longer NVT text
+	cr         bool          // the previous data byte was a CR
+	crOffset   int64
+	repeats    map[[2]byte]int
+	first      map[[2]byte]int64
+}
+
+// NewValidator returns a Validator for a new stream.
+func NewValidator() *Validator {
+	return &Validator{
+		negotiated: make(map[byte]bool),
+		repeats:    make(map[[2]byte]int),
+		first:      make(map[[2]byte]int64),
+	}
+}
+
+// Check validates the next token of the stream.
+func (v *Validator) Check(t Token) []Problem {
+	var problems []Problem
+	report := func(off int64, format string, args ...interface{}) {
+		problems = append(problems, Problem{off, fmt.Sprintf(format, args...)})
+	}
+
+	if t.Kind != Data && v.cr && !v.binary {
+		// a command between CR and its LF or NUL still leaves the CR bare
+		report(v.crOffset, "bare CR in NVT data")
+		v.cr = false
+	}
+
+	switch t.Kind {
+	case Data:
+		if v.binary {
+			break
+		}
+		for i, b := range t.Data {
+			if v.cr && b != '\n' && b != 0 {
+				report(v.crOffset, "bare CR in NVT data")
+			}
+			v.cr = b == '\r'
+			if v.cr {
+				v.crOffset = t.Offset + int64(i)
+			}
+		}
+	case Command:
+		switch {
+		case t.Cmd == se:
+			report(t.Offset, "IAC SE outside of a subnegotiation")
+		case t.Cmd < 236:
+			report(t.Offset, "unknown command %d", t.Cmd)
+		}
+	case Negotiation:
+		if t.Cmd == will || t.Cmd == do {
+			v.negotiated[t.Opt] = true
+		}
+		if t.Opt == 0 && (t.Cmd == will || t.Cmd == wont) {
+			v.binary = t.Cmd == will
+		}
+		key := [2]byte{t.Cmd, t.Opt}
+		if v.repeats[key] == 0 {
+			v.first[key] = t.Offset
+		}
+		v.repeats[key]++
+	case Subnegotiation:
+		if t.Unterminated {
+			report(t.Offset, "subnegotiation for %s not terminated by IAC SE", OptionName(t.Opt))
+		}
+		if !v.negotiated[t.Opt] {
+			report(t.Offset, "subnegotiation for %s before it was negotiated", OptionName(t.Opt))
+		}
+	}
+	return problems
+}
+
+// Finish reports problems that can only be seen once the stream has ended,
+// such as negotiation loops, in the order they started. err is the error that ended
+// the stream, if any, and is reported if the stream was cut off mid command.
+func (v *Validator) Finish(offset int64, err error) []Problem {
+	var problems []Problem
+	if err == io.ErrUnexpectedEOF {
+		problems = append(problems, Problem{offset, "stream ends in the middle of a command"})
+	}
+	for key, n := range v.repeats {
+		if n > maxRepeats {
+			problems = append(problems, Problem{v.first[key], fmt.Sprintf("negotiation loop: IAC %s %s sent %d times",
+				CommandName(key[0]), OptionName(key[1]), n)})
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Offset < problems[j].Offset })
+	return problems
+}
+
+// Validate checks a whole stream and returns every problem found, in stream order.
+// The returned error is only set for read errors; a truncated stream is reported
+// as a problem.
+func Validate(r io.Reader) ([]Problem, error) {
+	v := NewValidator()
+	t := Tokenize(r)
+	var problems []Problem
+	for {
+		tok, err := t.Next()
+		if err != nil {
+			problems = append(problems, v.Finish(tok.Offset, err)...)
+			sort.SliceStable(problems, func(i, j int) bool { return problems[i].Offset < problems[j].Offset })
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return problems, nil
+			}
+			return problems, err
+		}
+		problems = append(problems, v.Check(tok)...)
+	}
+}
@@ -0,0 +1,46 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate_Clean(t *testing.T) {
+	stream := []byte{255, 253, 24, 255, 250, 24, 1, 255, 240, 'o', 'k', '\r', '\n', 'a', '\r', 0}
+	problems, err := Validate(bytes.NewReader(stream))
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestValidate_Problems(t *testing.T) {
+	var stream []byte
+	stream = append(stream, 'a', '\r', 'b')                // 0: bare CR at 1
+	stream = append(stream, 255, 100)                      // 3: unknown command
+	stream = append(stream, 255, 240)                      // 5: SE outside SB
+	stream = append(stream, 255, 250, 31, 0, 80, 255, 240) // 7: SB before negotiation
+	for i := 0; i < 4; i++ {
+		stream = append(stream, 255, 253, 1) // 14: loop
+	}
+	stream = append(stream, 255, 251) // 26: truncated
+
+	problems, err := Validate(bytes.NewReader(stream))
+	assert.NoError(t, err)
+	expected := []Problem{
+		{1, "bare CR in NVT data"},
+		{3, "unknown command 100"},
+		{5, "IAC SE outside of a subnegotiation"},
+		{7, "subnegotiation for NAWS before it was negotiated"},
+		{14, "negotiation loop: IAC DO ECHO sent 4 times"},
+		{26, "stream ends in the middle of a command"},
+	}
+	assert.Equal(t, expected, problems)
+}
+
+func TestValidate_Binary(t *testing.T) {
+	stream := []byte{255, 251, 0, 'a', '\r', 'b', 255, 252, 0, 'a', '\r', 'b'}
+	problems, err := Validate(bytes.NewReader(stream))
+	assert.NoError(t, err)
+	assert.Equal(t, []Problem{{10, "bare CR in NVT data"}}, problems)
+}
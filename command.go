@@ -0,0 +1,158 @@
+package gote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/morganhein/go-telnet/codec"
+)
+
+// CommandHandler handles a two byte IAC <cmd> sequence received from the server.
+// It is called from the connection's processing goroutine once the input it came
+// with has been parsed, so it may use the connection, but must not block waiting
+// on Read or Flush, which wait on that goroutine. A returned error fails the
+// connection, and is returned from Read once the data received before it has
+// been read.
+type CommandHandler func(cmd byte) error
+
+// UnknownCommand is the behavior for commands outside the standard set (below EOF)
+// that have no registered handler.
+type UnknownCommand int
+
+const (
+	// IgnoreUnknown drops unknown commands. This is the default.
+	IgnoreUnknown UnknownCommand = iota
+	// FailUnknown fails the connection with an UnknownCommandError.
+	FailUnknown
+	// EventUnknown passes unknown commands to ReadEvent as events at their place in
+	// the data, like SetCommandEvents does for the standard ones.
+	EventUnknown
+)
+
+// UnknownCommandError is returned when the server sends a command outside the
+// standard set while FailUnknown is in effect.
+type UnknownCommandError byte
+
+func (e UnknownCommandError) Error() string {
+	return fmt.Sprintf("gote: unknown telnet command %d", byte(e))
+}
+
+// RegisterCommand sets the handler for IAC <cmd> sequences. Negotiation commands,
+// subnegotiation and escaped IAC bytes are always handled by the connection itself.
+// Passing a nil handler removes it.
+func (c *conn) RegisterCommand(cmd byte, h CommandHandler) {
+	c.cLock.Lock()
+	defer c.cLock.Unlock()
+	if h == nil {
+		delete(c.commands, cmd)
+		return
+	}
+	if c.commands == nil {
+		c.commands = make(map[byte]CommandHandler)
+	}
+	c.commands[cmd] = h
+}
+
+// SetCommandEvents sets whether standard commands without a handler are passed
+// to ReadEvent.
+func (c *conn) SetCommandEvents(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&c.cmdEvents, v)
+}
+
+// SetUnknownCommand sets what happens to unknown commands with no registered handler.
+func (c *conn) SetUnknownCommand(p UnknownCommand) {
+	c.cLock.Lock()
+	defer c.cLock.Unlock()
+	c.unknown = p
+}
+
+// Command consumes a two byte command from the input process and dispatches it to
+// its handler. Commands without a handler are passed to ReadEvent if
+// SetCommandEvents or EventUnknown say so, and otherwise ignored and counted in
+// Stats, unless FailUnknown fails the connection.
+func (c *conn) command(cmd byte) {
+	_ = c.i.Next(2)
+	c.cLock.Lock()
+	h, p := c.commands[cmd], c.unknown
+	c.cLock.Unlock()
+
+	switch {
+	case h != nil:
+		c.later(func() {
+			if err := h(cmd); err != nil {
+				c.fail(err)
+			}
+		})
+	case cmd < EOF && p == FailUnknown:
+		c.fail(UnknownCommandError(cmd))
+	case cmd < EOF && p == EventUnknown, cmd >= EOF && atomic.LoadInt32(&c.cmdEvents) == 1:
+		c.event(Event{Command: true, Cmd: cmd})
+	default:
+		c.ignore(cmd)
+	}
+}
+
+// SequenceError reports why a sequence passed to SendRawSequence was rejected.
+type SequenceError struct {
+	// Offset is the position in the sequence where the problem starts.
+	Offset int
+	Reason string
+}
+
+func (e *SequenceError) Error() string {
+	return fmt.Sprintf("gote: invalid telnet sequence at offset %d: %s", e.Offset, e.Reason)
+}
+
+// SendRawSequence writes one or more telnet commands to the server without escaping.
+// Every command must be a two byte IAC command from the standard set, an
+// IAC WILL/WONT/DO/DONT <opt> negotiation, or a complete IAC SB <opt> ... IAC SE
+// subnegotiation with any IAC in its payload doubled. Data bytes are rejected;
+// send those with Write.
+func (c *conn) SendRawSequence(b ...byte) error {
+	if err := validSequence(b); err != nil {
+		return err
+	}
+	c.sent(b)
+	return c.send(b)
+}
+
+// SendCommand sends IAC <cmd> for one of the two byte commands, from EOF (236) to
+// GA (249) except SE. DM is sent in band only: the TCP urgent notification that
+// should accompany it for a Synch isn't available through net.Conn.
+func (c *conn) SendCommand(cmd byte) error {
+	if cmd < EOF || cmd > GA || cmd == SE {
+		return &SequenceError{1, fmt.Sprintf("%s is not a two byte command", codec.CommandName(cmd))}
+	}
+	return c.send([]byte{IAC, cmd})
+}
+
+// validSequence checks that b is made up of well formed telnet commands only.
+func validSequence(b []byte) error {
+	if len(b) == 0 {
+		return &SequenceError{0, "empty sequence"}
+	}
+	t := codec.Tokenize(bytes.NewReader(b))
+	for {
+		tok, err := t.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &SequenceError{int(tok.Offset), "incomplete command"}
+		}
+		switch {
+		case tok.Kind == codec.Data:
+			return &SequenceError{int(tok.Offset), "data outside of a command"}
+		case tok.Kind == codec.Command && (tok.Cmd < EOF || tok.Cmd == SE):
+			return &SequenceError{int(tok.Offset), fmt.Sprintf("%s is not a standard command", codec.CommandName(tok.Cmd))}
+		case tok.Unterminated:
+			return &SequenceError{int(tok.Offset), "subnegotiation not terminated by IAC SE"}
+		}
+	}
+}
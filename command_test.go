@@ -0,0 +1,183 @@
+package gote
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommand_Handler(t *testing.T) {
+	tel := &conn{
+		i: bytes.NewBuffer(nil),
+		u: bytes.NewBuffer(nil),
+	}
+	var got []byte
+	tel.RegisterCommand(200, func(cmd byte) error {
+		got = append(got, cmd)
+		return nil
+	})
+
+	tel.i.Write([]byte{'a', IAC, 200, 'b', IAC, NOP, 'c'})
+	tel.parse()
+	tel.callbacks()
+	assert.Equal(t, []byte{200}, got)
+	assert.Equal(t, []byte("abc"), tel.u.Bytes())
+
+	tel.RegisterCommand(200, nil)
+	tel.i.Write([]byte{IAC, 200})
+	tel.parse()
+	tel.callbacks()
+	assert.Equal(t, []byte{200}, got)
+}
+
+func TestCommand_Unknown(t *testing.T) {
+	tel := &conn{
+		i:     bytes.NewBuffer(nil),
+		u:     bytes.NewBuffer(nil),
+		eLock: &sync.Mutex{},
+	}
+
+	tel.i.Write([]byte{IAC, 100, 'a'})
+	tel.parse()
+	tel.callbacks()
+	assert.NoError(t, tel.lastError)
+	assert.Equal(t, []byte("a"), tel.u.Bytes())
+
+	tel.SetUnknownCommand(FailUnknown)
+	// standard commands are never unknown
+	tel.i.Write([]byte{IAC, GA})
+	tel.parse()
+	tel.callbacks()
+	assert.NoError(t, tel.lastError)
+
+	tel.i.Write([]byte{IAC, 100})
+	tel.parse()
+	tel.callbacks()
+	assert.Equal(t, UnknownCommandError(100), tel.lastError)
+}
+
+func TestSendRawSequence(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{Conn: client}
+
+	valid := [][]byte{
+		{IAC, AYT},
+		{IAC, 242, IAC, EC},
+		{IAC, DO, ECHO, IAC, WILL, SGA},
+		{IAC, SB, 24, 0, 'x', IAC, IAC, IAC, SE},
+	}
+	for _, seq := range valid {
+		assert.NoError(t, tel.SendRawSequence(seq...))
+		assert.NoError(t, server.Expect(seq, time.Second))
+	}
+
+	invalid := [][]byte{
+		{},
+		{'a'},
+		{IAC, AYT, 'a'},
+		{IAC, 100},
+		{IAC, SE},
+		{IAC, DO},
+		{IAC, SB, 24, 0},
+		{IAC, SB, 24, 0, IAC, NOP},
+	}
+	for _, seq := range invalid {
+		err := tel.SendRawSequence(seq...)
+		_, ok := err.(*SequenceError)
+		assert.True(t, ok, seq)
+	}
+}
+
+func TestSendCommand(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{Conn: client}
+
+	for _, cmd := range []byte{EOF, SUSP, ABORT, EOR, NOP, DM, BRK, IP, AO, AYT, EC, EL, GA} {
+		assert.NoError(t, tel.SendCommand(cmd))
+		assert.NoError(t, server.Expect([]byte{IAC, cmd}, time.Second))
+	}
+	for _, cmd := range []byte{0, 235, SE, SB, WILL, IAC} {
+		assert.Error(t, tel.SendCommand(cmd))
+	}
+}
+
+func TestCommand_LineMode(t *testing.T) {
+	tel := &conn{
+		i:     bytes.NewBuffer(nil),
+		u:     bytes.NewBuffer(nil),
+		eLock: &sync.Mutex{},
+	}
+	tel.SetUnknownCommand(FailUnknown)
+	var got []byte
+	tel.RegisterCommand(SUSP, func(cmd byte) error {
+		got = append(got, cmd)
+		return nil
+	})
+
+	tel.i.Write([]byte{'a', IAC, EOF, IAC, SUSP, IAC, ABORT, IAC, EOR, IAC, DM, 'b'})
+	tel.parse()
+	tel.callbacks()
+	assert.NoError(t, tel.lastError)
+	assert.Equal(t, []byte{SUSP}, got)
+	assert.Equal(t, []byte("ab"), tel.u.Bytes())
+}
+
+func TestCommand_Events(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+	tel.SetCommandEvents(true)
+	tel.RegisterCommand(SUSP, func(cmd byte) error { return nil })
+
+	// handled commands aren't passed on
+	server.Write([]byte{'a', IAC, EOR, IAC, SUSP, 'b', IAC, DM})
+	b := make([]byte, 64)
+	var got []interface{}
+	for len(got) < 4 {
+		tel.SetReadDeadline(time.Now().Add(time.Second))
+		n, ev, err := tel.ReadEvent(b)
+		if !assert.NoError(t, err) {
+			return
+		}
+		if ev != nil {
+			got = append(got, *ev)
+		} else {
+			got = append(got, string(b[:n]))
+		}
+	}
+	assert.Equal(t, []interface{}{"a", Event{Command: true, Cmd: EOR}, "b", Event{Command: true, Cmd: DM}}, got)
+	assert.Equal(t, "command EOR", Event{Command: true, Cmd: EOR}.String())
+	assert.Empty(t, tel.Stats().Ignored)
+}
+
+func TestCommand_UnknownEvent(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+	tel.SetUnknownCommand(EventUnknown)
+
+	// standard commands are still ignored, SetCommandEvents being off
+	server.Write([]byte{'a', IAC, 0, IAC, NOP, IAC, 100, 'b'})
+	b := make([]byte, 64)
+	var got []interface{}
+	for len(got) < 4 {
+		tel.SetReadDeadline(time.Now().Add(time.Second))
+		n, ev, err := tel.ReadEvent(b)
+		if !assert.NoError(t, err) {
+			return
+		}
+		if ev != nil {
+			got = append(got, *ev)
+		} else {
+			got = append(got, string(b[:n]))
+		}
+	}
+	assert.Equal(t, []interface{}{"a", Event{Command: true, Cmd: 0}, Event{Command: true, Cmd: 100}, "b"}, got)
+	assert.Equal(t, map[byte]uint64{NOP: 1}, tel.Stats().Ignored)
+}
@@ -0,0 +1,42 @@
+package gote
+
+// Control groups the out-of-band commands of a connection, apart from its data,
+// for example to wire up the toolbar buttons of a terminal.
+type Control interface {
+	// Break sends IAC BRK.
+	Break() error
+	// InterruptProcess sends IAC IP.
+	InterruptProcess() error
+	// AbortOutput sends IAC AO.
+	AbortOutput() error
+	// AreYouThere sends IAC AYT. Servers usually answer with some visible text,
+	// which arrives as data.
+	AreYouThere() error
+	// EraseCharacter sends IAC EC.
+	EraseCharacter() error
+	// EraseLine sends IAC EL.
+	EraseLine() error
+	// Handle sets the handler for a command received from the server, like
+	// Connection.RegisterCommand.
+	Handle(cmd byte, h CommandHandler)
+}
+
+type control struct {
+	c *conn
+}
+
+// Control returns the out-of-band commands of the connection.
+func (c *conn) Control() Control {
+	return control{c}
+}
+
+func (ctl control) Break() error            { return ctl.c.SendCommand(BRK) }
+func (ctl control) InterruptProcess() error { return ctl.c.SendCommand(IP) }
+func (ctl control) AbortOutput() error      { return ctl.c.SendCommand(AO) }
+func (ctl control) AreYouThere() error      { return ctl.c.SendCommand(AYT) }
+func (ctl control) EraseCharacter() error   { return ctl.c.SendCommand(EC) }
+func (ctl control) EraseLine() error        { return ctl.c.SendCommand(EL) }
+
+func (ctl control) Handle(cmd byte, h CommandHandler) {
+	ctl.c.RegisterCommand(cmd, h)
+}
@@ -0,0 +1,44 @@
+package gote
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControl(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{
+		Conn: client,
+		i:    bytes.NewBuffer(nil),
+		u:    bytes.NewBuffer(nil),
+	}
+	ctl := tel.Control()
+	for _, c := range []struct {
+		send func() error
+		cmd  byte
+	}{
+		{ctl.Break, BRK},
+		{ctl.InterruptProcess, IP},
+		{ctl.AbortOutput, AO},
+		{ctl.AreYouThere, AYT},
+		{ctl.EraseCharacter, EC},
+		{ctl.EraseLine, EL},
+	} {
+		assert.NoError(t, c.send())
+		assert.NoError(t, server.Expect([]byte{IAC, c.cmd}, time.Second))
+	}
+
+	var got []byte
+	ctl.Handle(DM, func(cmd byte) error {
+		got = append(got, cmd)
+		return nil
+	})
+	tel.i.Write([]byte{IAC, DM})
+	tel.parse()
+	tel.callbacks()
+	assert.Equal(t, []byte{DM}, got)
+}
@@ -0,0 +1,31 @@
+package gote
+
+// OnData registers fn to receive decoded data instead of buffering it for Read.
+func (c *conn) OnData(fn func(b []byte)) {
+	c.cLock.Lock()
+	c.onData = fn
+	c.cLock.Unlock()
+	// hand over what is already buffered without waiting for more input
+	if fn != nil && c.wake != nil {
+		notify(c.wake)
+	}
+}
+
+// Dispatch hands everything buffered upstream to the OnData callback, if any.
+// The callback is called without holding any locks, so it may use the connection.
+func (c *conn) dispatch() {
+	c.cLock.Lock()
+	fn := c.onData
+	c.cLock.Unlock()
+	if fn == nil {
+		return
+	}
+	c.uLock.Lock()
+	c.chunk = append(c.chunk[:0], c.u.Bytes()...)
+	c.u.Reset()
+	c.consume(len(c.chunk))
+	c.uLock.Unlock()
+	if len(c.chunk) > 0 {
+		fn(c.chunk)
+	}
+}
@@ -0,0 +1,58 @@
+package gote
+
+import (
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnData(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	// buffered before the callback is registered
+	server.Write([]byte("ab"))
+	time.Sleep(time.Duration(150) * time.Millisecond)
+
+	got := make(chan string, 10)
+	tel.OnData(func(b []byte) {
+		got <- string(b)
+	})
+	// delivered without anything more coming in
+	var s string
+	for s != "ab" {
+		select {
+		case b := <-got:
+			s += b
+		case <-time.After(time.Second):
+			t.Fatalf("only got %q", s)
+		}
+	}
+	server.Write([]byte{'c', IAC, NOP, 'd'})
+	for s != "abcd" {
+		select {
+		case b := <-got:
+			s += b
+		case <-time.After(time.Second):
+			t.Fatalf("only got %q", s)
+		}
+	}
+
+	// the callback may write replies itself
+	tel.OnData(func(b []byte) {
+		tel.Write(b)
+	})
+	server.Write([]byte("echo"))
+	assert.NoError(t, server.Expect([]byte("echo"), time.Second))
+
+	tel.OnData(nil)
+	server.Write([]byte("read"))
+	b := make([]byte, 4)
+	_, err := ReadFull(tel, b)
+	assert.NoError(t, err)
+	assert.Equal(t, "read", string(b))
+}
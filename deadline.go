@@ -0,0 +1,46 @@
+package gote
+
+import (
+	"net"
+	"time"
+)
+
+// ErrTimeout is returned by Read once the read deadline has passed. Its Timeout
+// method returns true, as with the errors of net.Conn, and from Go 1.15 on it
+// matches os.ErrDeadlineExceeded with errors.Is.
+var ErrTimeout net.Error = timeoutError{}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "gote: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// SetReadDeadline sets the deadline for Read. It isn't passed on to the underlying
+// connection, whose reads would fail the connection on timeout.
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.dLock.Lock()
+	c.deadline = t
+	if c.moved != nil {
+		close(c.moved)
+		c.moved = nil
+	}
+	c.dLock.Unlock()
+	return nil
+}
+
+// SetDeadline sets the read deadline, and the write deadline of the underlying connection.
+func (c *conn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// readDeadline returns the read deadline, and a channel closed when it changes.
+func (c *conn) readDeadline() (time.Time, <-chan struct{}) {
+	c.dLock.Lock()
+	defer c.dLock.Unlock()
+	if c.moved == nil {
+		c.moved = make(chan struct{})
+	}
+	return c.deadline, c.moved
+}
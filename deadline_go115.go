@@ -0,0 +1,12 @@
+//go:build go1.15
+// +build go1.15
+
+package gote
+
+import "os"
+
+// Is makes errors.Is(ErrTimeout, os.ErrDeadlineExceeded) true, as it is for the
+// deadline errors of net.Conn.
+func (timeoutError) Is(target error) bool {
+	return target == os.ErrDeadlineExceeded
+}
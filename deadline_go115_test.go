@@ -0,0 +1,26 @@
+//go:build go1.15
+// +build go1.15
+
+package gote
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadDeadline_DeadlineExceeded(t *testing.T) {
+	client, _ := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	tel.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err := tel.Read(make([]byte, 1))
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+	assert.False(t, errors.Is(err, os.ErrClosed))
+}
@@ -0,0 +1,43 @@
+package gote
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadDeadline(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+	b := make([]byte, 8)
+
+	tel.SetReadDeadline(time.Now().Add(time.Duration(30) * time.Millisecond))
+	start := time.Now()
+	_, err := tel.Read(b)
+	assert.Equal(t, ErrTimeout, err)
+	assert.True(t, err.(net.Error).Timeout())
+	assert.True(t, time.Since(start) >= time.Duration(30)*time.Millisecond)
+
+	// the connection carries on, and a passed deadline wins over buffered data
+	server.Write([]byte("hi"))
+	time.Sleep(time.Duration(20) * time.Millisecond)
+	_, err = tel.Read(b)
+	assert.Equal(t, ErrTimeout, err)
+	tel.SetReadDeadline(time.Time{})
+	n, err := tel.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", string(b[:n]))
+
+	// moving the deadline wakes a waiting Read
+	go func() {
+		time.Sleep(time.Duration(20) * time.Millisecond)
+		tel.SetReadDeadline(time.Now())
+	}()
+	_, err = tel.Read(b)
+	assert.Equal(t, ErrTimeout, err)
+}
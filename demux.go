@@ -0,0 +1,102 @@
+package gote
+
+import (
+	"sync"
+)
+
+// defaultDemuxBuffer is the number of lines a demultiplexed stream holds.
+const defaultDemuxBuffer = 64
+
+// Classifier names the stream a line belongs to. Lines given a name that isn't one
+// of the Demux streams go to the default stream, named "".
+type Classifier func(line string) string
+
+// Demux splits the lines of a decoded stream into named streams, each read on its
+// own, for example to watch the alarms of a console apart from its syslog output.
+//
+// Each stream holds up to Buffer lines. Once one is full, the Demux stops reading
+// until it is read from, so backpressure reaches the connection; a stream nobody
+// reads holds up all the others once full.
+type Demux struct {
+	// Buffer is the number of lines each stream holds. Zero means 64. It must be
+	// set before the first read.
+	Buffer int
+
+	lr       *LineReader
+	classify Classifier
+	streams  map[string]*DemuxStream
+	once     sync.Once
+}
+
+// DemuxStream is one of the streams of a Demux.
+type DemuxStream struct {
+	d     *Demux
+	lines chan demuxLine
+	err   error
+}
+
+type demuxLine struct {
+	line      string
+	isPartial bool
+}
+
+// NewDemux returns a Demux reading lines from lr, with a stream for each of names
+// plus the default stream.
+func NewDemux(lr *LineReader, classify Classifier, names ...string) *Demux {
+	d := &Demux{
+		lr:       lr,
+		classify: classify,
+		streams:  make(map[string]*DemuxStream),
+	}
+	for _, name := range append(names, "") {
+		d.streams[name] = &DemuxStream{d: d}
+	}
+	return d
+}
+
+// Stream returns the named stream, or nil if there is no such stream.
+func (d *Demux) Stream(name string) *DemuxStream {
+	return d.streams[name]
+}
+
+// start makes the stream buffers and starts reading, on the first read of any stream.
+func (d *Demux) start() {
+	size := d.Buffer
+	if size <= 0 {
+		size = defaultDemuxBuffer
+	}
+	for _, s := range d.streams {
+		s.lines = make(chan demuxLine, size)
+	}
+	go d.run()
+}
+
+// run routes lines until the source fails, which ends every stream.
+func (d *Demux) run() {
+	for {
+		line, isPartial, err := d.lr.ReadLine()
+		if err != nil {
+			for _, s := range d.streams {
+				s.err = err
+				close(s.lines)
+			}
+			return
+		}
+		s, ok := d.streams[d.classify(line)]
+		if !ok {
+			s = d.streams[""]
+		}
+		s.lines <- demuxLine{line, isPartial}
+	}
+}
+
+// ReadLine returns the next line routed to the stream, like LineReader.ReadLine.
+// Once the source fails, the stream's remaining lines are returned first.
+func (s *DemuxStream) ReadLine() (line string, isPartial bool, err error) {
+	s.d.once.Do(s.d.start)
+	l, ok := <-s.lines
+	if !ok {
+		return "", false, s.err
+	}
+	return l.line, l.isPartial, nil
+}
@@ -0,0 +1,88 @@
+package gote
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDemux(t *testing.T) {
+	in := "%LINK-3-UPDOWN: down\r\nshow run\r\n%SYS-5-CONFIG: done\r\nALARM fan\r\nrouter#"
+	d := NewDemux(NewLineReader(bytes.NewReader([]byte(in))), func(line string) string {
+		switch {
+		case strings.HasPrefix(line, "%"):
+			return "syslog"
+		case strings.HasPrefix(line, "ALARM"):
+			return "alarm"
+		}
+		return "other"
+	}, "syslog", "alarm")
+	assert.Nil(t, d.Stream("other"))
+
+	alarm := d.Stream("alarm")
+	line, partial, err := alarm.ReadLine()
+	assert.NoError(t, err)
+	assert.False(t, partial)
+	assert.Equal(t, "ALARM fan", line)
+	_, _, err = alarm.ReadLine()
+	assert.Equal(t, io.EOF, err)
+
+	syslog := d.Stream("syslog")
+	for _, expected := range []string{"%LINK-3-UPDOWN: down", "%SYS-5-CONFIG: done"} {
+		line, _, err = syslog.ReadLine()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, line)
+	}
+
+	// unknown names go to the default stream
+	rest := d.Stream("")
+	line, partial, err = rest.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "show run", line)
+	line, partial, err = rest.ReadLine()
+	assert.NoError(t, err)
+	assert.True(t, partial)
+	assert.Equal(t, "router#", line)
+	_, _, err = rest.ReadLine()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestDemux_Backpressure(t *testing.T) {
+	pr, pw := io.Pipe()
+	d := NewDemux(NewLineReader(pr), func(line string) string { return line[:1] }, "a", "b")
+	d.Buffer = 1
+
+	written := make(chan struct{})
+	go func() {
+		pw.Write([]byte("a1\na2\na3\nb1\n"))
+		close(written)
+	}()
+	// b1 can't get through while the full a stream isn't read
+	b := d.Stream("b")
+	got := make(chan string)
+	go func() {
+		line, _, _ := b.ReadLine()
+		got <- line
+	}()
+	select {
+	case <-got:
+		t.Fatal("read past a full stream")
+	case <-time.After(time.Duration(50) * time.Millisecond):
+	}
+	a := d.Stream("a")
+	for i := 0; i < 3; i++ {
+		a.ReadLine()
+	}
+	select {
+	case line := <-got:
+		assert.Equal(t, "b1", line)
+	case <-time.After(time.Second):
+		t.Fatal("never unblocked")
+	}
+	<-written
+	pw.Close()
+}
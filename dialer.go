@@ -0,0 +1,82 @@
+package gote
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Dialer contains options for connecting to a telnet server, like net.Dialer does
+// for TCP. The zero value connects like Dial.
+type Dialer struct {
+	// Timeout is the most to wait for the connection to be made, as in net.Dialer.
+	Timeout time.Duration
+	// LocalAddr is the local address to connect from, as in net.Dialer.
+	LocalAddr net.Addr
+	// AcceptedOptions lists options agreed to whenever the server offers them with
+	// WILL or asks for them with DO, in place of the defaults. It is meant for
+	// options that need nothing more than agreeing to, such as ECHO or EOR; use
+	// RegisterOption for anything that needs subnegotiation.
+	AcceptedOptions []byte
+	// RefusedOptions lists options always refused, with DONT or WONT, including
+	// ones that would be agreed to by default, such as SGA and BINARY. An option
+	// in both lists is refused.
+	RefusedOptions []byte
+	// TerminalType lists the terminal types reported, see Connection.SetTerminalType.
+	TerminalType []string
+	// WindowSize is the window size reported, see Connection.SetWindowSize. The zero
+	// value leaves NAWS refused.
+	WindowSize WindowSize
+	// Environ holds the environment variables reported, see Connection.SetEnviron.
+	Environ map[string]string
+	// MaxReplies is the most negotiation replies sent for each option per second.
+	// Requests over it go unanswered, so a peer flooding them can't use the
+	// connection as an amplifier. 0 means 10, and a negative value removes the cap.
+	MaxReplies int
+}
+
+// Dial connects to the address on the named network.
+func (d *Dialer) Dial(network, address string) (Connection, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects like Dial, with ctx bounding both connecting and the life
+// of the connection, as in the package level DialContext.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (Connection, error) {
+	c := &conn{}
+	return c.dial(ctx, d, network, address)
+}
+
+// configure sets up a connection that hasn't started yet.
+func (d *Dialer) configure(c *conn) error {
+	c.maxReplies = d.MaxReplies
+	for _, opt := range d.AcceptedOptions {
+		c.RegisterOption(opt, policyOption{accept: true})
+	}
+	for _, opt := range d.RefusedOptions {
+		c.RegisterOption(opt, policyOption{})
+	}
+	if len(d.TerminalType) > 0 {
+		c.SetTerminalType(d.TerminalType...)
+	}
+	if d.WindowSize != (WindowSize{}) {
+		if err := c.SetWindowSize(d.WindowSize.Width, d.WindowSize.Height); err != nil {
+			return err
+		}
+	}
+	if d.Environ != nil {
+		return c.SetEnviron(d.Environ)
+	}
+	return nil
+}
+
+// policyOption agrees to or refuses an option, and does nothing else.
+type policyOption struct {
+	BaseOption
+	accept bool
+}
+
+// Accept agrees if the option is accepted.
+func (p policyOption) Accept(cmd byte) bool {
+	return p.accept
+}
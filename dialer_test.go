@@ -0,0 +1,89 @@
+package gote
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	expected := append([]byte{IAC, DO, RFC, IAC, DONT, SGA, IAC, WILL, TTYPE}, Subnegotiation(TTYPE, IS, []byte("VT100"))...)
+	got := make(chan []byte, 1)
+	go func() {
+		s, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer s.Close()
+		// sent before the client could change anything after connecting
+		s.Write([]byte{IAC, WILL, RFC, IAC, WILL, SGA, IAC, DO, TTYPE})
+		s.Write(Subnegotiation(TTYPE, SEND, nil))
+		b := make([]byte, len(expected))
+		s.SetReadDeadline(time.Now().Add(time.Second))
+		n, _ := io.ReadFull(s, b)
+		got <- b[:n]
+	}()
+
+	d := &Dialer{
+		Timeout:         time.Second,
+		AcceptedOptions: []byte{RFC},
+		RefusedOptions:  []byte{SGA},
+		TerminalType:    []string{"VT100"},
+	}
+	tel, err := d.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tel.Close()
+	assert.Equal(t, expected, <-got)
+}
+
+func TestDialer_WindowSizeEnviron(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	expected := []byte{IAC, WILL, NAWS, IAC, SB, NAWS, 0, 80, 0, 24, IAC, SE, IAC, WILL, 39}
+	expected = append(expected, Subnegotiation(39, IS, []byte("\x00USER\x01gandalf"))...)
+	got := make(chan []byte, 1)
+	go func() {
+		s, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer s.Close()
+		// asked for right away, before SetWindowSize or SetEnviron could be called
+		s.Write([]byte{IAC, DO, NAWS, IAC, DO, 39})
+		s.Write(Subnegotiation(39, SEND, nil))
+		b := make([]byte, len(expected))
+		s.SetReadDeadline(time.Now().Add(time.Second))
+		n, _ := io.ReadFull(s, b)
+		got <- b[:n]
+	}()
+
+	d := &Dialer{
+		WindowSize: WindowSize{Width: 80, Height: 24},
+		Environ:    map[string]string{"USER": "gandalf"},
+	}
+	tel, err := d.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tel.Close()
+	assert.Equal(t, expected, <-got)
+
+	d = &Dialer{WindowSize: WindowSize{Width: 1 << 16}}
+	_, err = d.Dial("tcp", l.Addr().String())
+	assert.Equal(t, ErrWindowSize, err)
+}
@@ -0,0 +1,167 @@
+package gote
+
+import "bytes"
+
+// LineDiscipline decides what happens to the data of a connection on top of IAC
+// escaping: how what is passed to Write goes out, and how what the server sends
+// comes in. It is told on every call whether that direction is in binary mode
+// (RFC 856), so it follows the negotiation as it changes. Output and Input are
+// called from the writing goroutine and the processing goroutine respectively.
+type LineDiscipline interface {
+	// Output returns the data to send for b, which is passed to Write. It may
+	// return b itself, and must not keep it.
+	Output(b []byte, binary bool) []byte
+	// Input passes the data in b, decoded from the server, on to up, in as many
+	// calls as it needs. b and what up is given are only valid until it returns.
+	Input(b []byte, binary bool, up func([]byte))
+}
+
+// Raw is the LineDiscipline passing data through as is in both directions.
+type Raw struct{}
+
+// Output returns b.
+func (Raw) Output(b []byte, binary bool) []byte { return b }
+
+// Input passes b on.
+func (Raw) Input(b []byte, binary bool, up func([]byte)) { up(b) }
+
+// NVT is the LineDiscipline of the network virtual terminal of RFC 854, and the
+// default. Its rules only apply to a direction while it isn't in binary mode.
+// The zero value passes data through like Raw.
+type NVT struct {
+	// TranslateNewlines sends a bare "\n" as the telnet newline "\r\n", and a bare
+	// "\r" as "\r\x00". A CR LF pair is only recognised within a single Write.
+	TranslateNewlines bool
+	// StripNUL drops the NUL bytes the server sends, which RFC 854 treats as padding.
+	StripNUL bool
+}
+
+// Output translates newlines if asked to.
+func (n NVT) Output(b []byte, binary bool) []byte {
+	if !n.TranslateNewlines || binary {
+		return b
+	}
+	return translateNewlines(b)
+}
+
+// Input drops NULs if asked to.
+func (n NVT) Input(b []byte, binary bool, up func([]byte)) {
+	if !n.StripNUL || binary {
+		up(b)
+		return
+	}
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, 0)
+		if i == -1 {
+			up(b)
+			return
+		}
+		up(b[:i])
+		b = b[i+1:]
+	}
+}
+
+// translateNewlines turns bare LF and CR into CR LF and CR NUL.
+func translateNewlines(b []byte) []byte {
+	out := make([]byte, 0, len(b)+len(b)/8)
+	for i, c := range b {
+		switch {
+		case c == '\n' && (i == 0 || b[i-1] != '\r'):
+			out = append(out, '\r', '\n')
+		case c == '\r' && (i == len(b)-1 || b[i+1] != '\n'):
+			out = append(out, '\r', 0)
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// LocalEdit is the LineDiscipline for editing lines locally, as LINEMODE's EDIT
+// mode (RFC 1184) does: what is written is held back until a newline, with
+// backspace and DEL erasing the last character held and ^U the whole line, and
+// only the edited line goes out, newline included, by the rules of NVT. Input is
+// handled by NVT alone. In binary mode data goes out as is, and anything held
+// back goes with it. Use a new LocalEdit for each connection, from one writer at
+// a time.
+type LocalEdit struct {
+	NVT
+	line []byte
+}
+
+// Output edits b into the line held back, and returns the lines it completes.
+func (l *LocalEdit) Output(b []byte, binary bool) []byte {
+	if binary {
+		out := append(l.line, b...)
+		l.line = l.line[:0:0]
+		return out
+	}
+	var out []byte
+	for _, c := range b {
+		switch c {
+		case '\b', 0x7f:
+			if len(l.line) > 0 {
+				l.line = l.line[:len(l.line)-1]
+			}
+		case 0x15: // ^U
+			l.line = l.line[:0]
+		case '\r', '\n':
+			out = append(append(out, l.line...), c)
+			l.line = l.line[:0]
+		default:
+			l.line = append(l.line, c)
+		}
+	}
+	return l.NVT.Output(out, false)
+}
+
+// Pending returns the part of the line held back so far, such as for redrawing it.
+func (l *LocalEdit) Pending() []byte {
+	return l.line
+}
+
+// defaultDiscipline is made once, so that using it doesn't allocate.
+var defaultDiscipline LineDiscipline = NVT{}
+
+// SetLineDiscipline sets the line discipline, which takes effect from the next
+// Write and the next data received. nil goes back to the default, NVT.
+func (c *conn) SetLineDiscipline(d LineDiscipline) {
+	c.cLock.Lock()
+	c.discipline = d
+	c.cLock.Unlock()
+}
+
+// lineDiscipline returns the line discipline in use.
+func (c *conn) lineDiscipline() LineDiscipline {
+	c.cLock.Lock()
+	defer c.cLock.Unlock()
+	if c.discipline == nil {
+		return defaultDiscipline
+	}
+	return c.discipline
+}
+
+// SetTranslateNewlines sets NVT.TranslateNewlines, switching to NVT if another
+// line discipline is in use.
+func (c *conn) SetTranslateNewlines(on bool) {
+	c.cLock.Lock()
+	defer c.cLock.Unlock()
+	n, _ := c.discipline.(NVT)
+	n.TranslateNewlines = on
+	c.discipline = n
+}
+
+// SetStripNUL sets NVT.StripNUL, switching to NVT if another line discipline is
+// in use.
+func (c *conn) SetStripNUL(on bool) {
+	c.cLock.Lock()
+	defer c.cLock.Unlock()
+	n, _ := c.discipline.(NVT)
+	n.StripNUL = on
+	c.discipline = n
+}
+
+// localBinary reports whether the connection sends binary.
+func (c *conn) localBinary() bool {
+	return c.sides(BIN)&ourSide != 0
+}
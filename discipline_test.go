@@ -0,0 +1,74 @@
+package gote
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNVT(t *testing.T) {
+	n := NVT{TranslateNewlines: true, StripNUL: true}
+	assert.Equal(t, []byte("a\r\nb\r\x00"), n.Output([]byte("a\nb\r"), false))
+	// binary mode turns it off
+	assert.Equal(t, []byte("a\nb\r"), n.Output([]byte("a\nb\r"), true))
+
+	var got []byte
+	up := func(b []byte) { got = append(got, b...) }
+	n.Input([]byte("a\x00b"), false, up)
+	n.Input([]byte("c\x00d"), true, up)
+	assert.Equal(t, []byte("abc\x00d"), got)
+}
+
+func TestRaw(t *testing.T) {
+	var r Raw
+	assert.Equal(t, []byte("a\n\x00"), r.Output([]byte("a\n\x00"), false))
+	var got []byte
+	r.Input([]byte("a\x00"), false, func(b []byte) { got = append(got, b...) })
+	assert.Equal(t, []byte("a\x00"), got)
+}
+
+func TestLocalEdit(t *testing.T) {
+	l := &LocalEdit{NVT: NVT{TranslateNewlines: true}}
+	// held back until the end of the line
+	assert.Empty(t, l.Output([]byte("shw"), false))
+	assert.Equal(t, []byte("shw"), l.Pending())
+	assert.Equal(t, []byte("show ver\r\n"), l.Output([]byte("\bow vr\x7fx\ber\n"), false))
+	assert.Empty(t, l.Output([]byte("reload\x15"), false))
+	assert.Empty(t, l.Pending())
+	// binary mode sends what is held along with the rest
+	l.Output([]byte("ab"), false)
+	assert.Equal(t, []byte("ab\bc"), l.Output([]byte("\bc"), true))
+}
+
+func TestSetLineDiscipline(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{
+		Conn: client,
+		i:    bytes.NewBuffer(nil),
+		u:    bytes.NewBuffer(nil),
+	}
+	tel.SetLineDiscipline(&LocalEdit{})
+	n, err := tel.Write([]byte("ab\bc"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	tel.Write([]byte("\n"))
+	assert.NoError(t, server.Expect([]byte("ac\n"), time.Second))
+
+	// switching with SetTranslateNewlines goes back to NVT
+	tel.SetTranslateNewlines(true)
+	tel.Write([]byte("x\b\n"))
+	assert.NoError(t, server.Expect([]byte("x\b\r\n"), time.Second))
+
+	// and follows binary mode as it is negotiated
+	tel.i.Write([]byte{IAC, DO, BIN})
+	tel.parse()
+	tel.Write([]byte("\n"))
+	assert.NoError(t, server.Expect([]byte("\n"), time.Second))
+
+	tel.SetLineDiscipline(nil)
+	tel.Write([]byte("\n"))
+	assert.NoError(t, server.Expect([]byte("\n"), time.Second))
+}
@@ -0,0 +1,60 @@
+package gote
+
+import (
+	"context"
+	"time"
+)
+
+// Flush waits for the processing goroutine to parse what has been read and write
+// out the replies.
+func (c *conn) Flush(ctx context.Context) error {
+	if c.ctx == nil {
+		return nil
+	}
+	ack := make(chan error, 1)
+	select {
+	case c.flushes <- ack:
+	case <-c.ctx.Done():
+		return c.ended()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-ack:
+		return err
+	case <-c.ctx.Done():
+		return c.ended()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetDrainTimeout sets how long Close waits to flush pending replies.
+func (c *conn) SetDrainTimeout(d time.Duration) {
+	c.cLock.Lock()
+	c.drainTimeout = d
+	c.cLock.Unlock()
+}
+
+// Drain flushes pending replies before Close, if there is a drain timeout.
+func (c *conn) drain() {
+	c.cLock.Lock()
+	d := c.drainTimeout
+	c.cLock.Unlock()
+	if d <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	c.Flush(ctx)
+}
+
+// Ended returns why the connection ended, for calls that find it gone.
+func (c *conn) ended() error {
+	c.eLock.Lock()
+	defer c.eLock.Unlock()
+	if c.lastError == nil {
+		return ErrClosed
+	}
+	return c.lastError
+}
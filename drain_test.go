@@ -0,0 +1,38 @@
+package gote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlush(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+
+	server.Write([]byte{IAC, DO, TTYPE})
+	time.Sleep(time.Duration(20) * time.Millisecond)
+	// once read by the connection, Flush returns after it was answered
+	assert.NoError(t, tel.Flush(context.Background()))
+	assert.NoError(t, server.Expect([]byte{IAC, WONT, TTYPE}, time.Duration(10)*time.Millisecond))
+
+	tel.Close()
+	assert.Equal(t, ErrClosed, tel.Flush(context.Background()))
+}
+
+func TestDrainTimeout(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	tel.SetDrainTimeout(time.Second)
+
+	server.Write([]byte{IAC, DO, TTYPE})
+	time.Sleep(time.Duration(20) * time.Millisecond)
+	tel.Close()
+	// the reply still went out before the connection closed
+	assert.NoError(t, server.Expect([]byte{IAC, WONT, TTYPE}, time.Second))
+}
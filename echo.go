@@ -0,0 +1,49 @@
+package gote
+
+import "sync/atomic"
+
+// remoteEcho agrees to the server echoing, and refuses to echo for it.
+type remoteEcho struct {
+	BaseOption
+}
+
+// Accept agrees to WILL ECHO.
+func (remoteEcho) Accept(cmd byte) bool {
+	return cmd == WILL
+}
+
+// RemoteEcho reports whether the server echoes what is sent to it.
+func (c *conn) RemoteEcho() bool {
+	return atomic.LoadInt32(&c.echo) == 1
+}
+
+// OnRemoteEcho sets the callback for changes of remote echo.
+func (c *conn) OnRemoteEcho(fn func(on bool)) {
+	c.cLock.Lock()
+	c.onEcho = fn
+	c.cLock.Unlock()
+}
+
+func (c *conn) setRemoteEcho(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&c.echo, v)
+}
+
+// reportEcho calls the OnRemoteEcho callback if remote echo changed since it was
+// last called. It runs on the processing goroutine, without holding any locks.
+func (c *conn) reportEcho() {
+	on := c.RemoteEcho()
+	if on == c.echoReported {
+		return
+	}
+	c.echoReported = on
+	c.cLock.Lock()
+	fn := c.onEcho
+	c.cLock.Unlock()
+	if fn != nil {
+		fn(on)
+	}
+}
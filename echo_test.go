@@ -0,0 +1,36 @@
+package gote
+
+import (
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteEcho(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	changes := make(chan bool, 4)
+	tel.OnRemoteEcho(func(on bool) { changes <- on })
+	tel.start(client)
+	defer tel.Close()
+	assert.False(t, tel.RemoteEcho())
+
+	err := server.Play(time.Second,
+		fake.Step{Send: []byte{IAC, WILL, ECHO}, Expect: []byte{IAC, DO, ECHO}},
+		// asking us to echo is refused
+		fake.Step{Send: []byte{IAC, DO, ECHO}, Expect: []byte{IAC, WONT, ECHO}},
+	)
+	assert.NoError(t, err)
+	assert.True(t, <-changes)
+	assert.True(t, tel.RemoteEcho())
+	assert.True(t, tel.Capabilities().Supports(FeatureRemoteEcho))
+
+	// repeating the offer isn't answered, and turning it off is
+	err = server.Play(time.Second, fake.Step{Send: []byte{IAC, WILL, ECHO, IAC, WONT, ECHO}, Expect: []byte{IAC, DONT, ECHO}})
+	assert.NoError(t, err)
+	assert.False(t, <-changes)
+	assert.False(t, tel.RemoteEcho())
+	assert.Len(t, changes, 0)
+}
@@ -0,0 +1,204 @@
+// Package environ encodes and decodes the variable lists carried in NEW-ENVIRON
+// (option 39, RFC 1572) subnegotiations. Only the payload after the qualifier is
+// handled here; wrap it with gote.Subnegotiation to get a sequence ready to send.
+package environ
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Option is the telnet option code of NEW-ENVIRON.
+const Option = 39
+
+// LegacyOption is the telnet option code of the original ENVIRON (RFC 1408),
+// which some old servers speak instead of NEW-ENVIRON.
+const LegacyOption = 36
+
+// Type codes used inside the variable list.
+const (
+	VAR     = 0
+	VALUE   = 1
+	ESC     = 2
+	USERVAR = 3
+)
+
+// Well-known variable names. These are sent as VAR, anything else as USERVAR.
+const (
+	User       = "USER"
+	Job        = "JOB"
+	Acct       = "ACCT"
+	Printer    = "PRINTER"
+	SystemType = "SYSTEMTYPE"
+	Display    = "DISPLAY"
+)
+
+var wellKnown = map[string]bool{
+	User:       true,
+	Job:        true,
+	Acct:       true,
+	Printer:    true,
+	SystemType: true,
+	Display:    true,
+}
+
+// WellKnown reports whether name is one of the variables defined by RFC 1572.
+func WellKnown(name string) bool {
+	return wellKnown[name]
+}
+
+// Var is a single environment variable.
+type Var struct {
+	Name  string
+	Value string
+	// User is set for user defined variables, sent as USERVAR.
+	User bool
+	// Unset means the variable has no value at all, which is different from an
+	// empty Value. Unset variables are sent without a VALUE, as in a SEND list or
+	// in an IS reply for a variable that isn't defined.
+	Unset bool
+}
+
+// New returns a variable classified as VAR or USERVAR by its name.
+func New(name, value string) Var {
+	return Var{Name: name, Value: value, User: !WellKnown(name)}
+}
+
+// Names returns unset variables for names, classified like New does,
+// to ask for them in a SEND.
+func Names(names ...string) []Var {
+	vars := make([]Var, len(names))
+	for i, n := range names {
+		vars[i] = New(n, "")
+		vars[i].Unset = true
+	}
+	return vars
+}
+
+// Encode returns the variable list for vars, escaping any type codes found in
+// names and values. IAC bytes are left for gote.Subnegotiation to escape.
+func Encode(vars ...Var) []byte {
+	var b []byte
+	for _, v := range vars {
+		if v.User {
+			b = append(b, USERVAR)
+		} else {
+			b = append(b, VAR)
+		}
+		b = escape(b, v.Name)
+		if !v.Unset {
+			b = append(b, VALUE)
+			b = escape(b, v.Value)
+		}
+	}
+	return b
+}
+
+func escape(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case VAR, VALUE, ESC, USERVAR:
+			b = append(b, ESC)
+		}
+		b = append(b, s[i])
+	}
+	return b
+}
+
+// ErrTrailingEscape is returned by Decode for a list ending in an ESC.
+var ErrTrailingEscape = errors.New("environ: list ends with ESC")
+
+// Decode parses a variable list, as found after the qualifier of an IS or INFO
+// reply, or of a SEND request where values are absent.
+func Decode(b []byte) ([]Var, error) {
+	var vars []Var
+	var cur *Var
+	inValue := false
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch c {
+		case VAR, USERVAR:
+			vars = append(vars, Var{User: c == USERVAR, Unset: true})
+			cur = &vars[len(vars)-1]
+			inValue = false
+			continue
+		case VALUE:
+			if cur == nil {
+				return nil, fmt.Errorf("environ: VALUE at offset %d without a variable", i)
+			}
+			cur.Unset = false
+			inValue = true
+			continue
+		case ESC:
+			i++
+			if i == len(b) {
+				return nil, ErrTrailingEscape
+			}
+			c = b[i]
+		}
+		if cur == nil {
+			return nil, fmt.Errorf("environ: data at offset %d before any variable", i)
+		}
+		if inValue {
+			cur.Value += string(c)
+		} else {
+			cur.Name += string(c)
+		}
+	}
+	return vars, nil
+}
+
+// DecodeLegacy parses a variable list of the original ENVIRON option. Many
+// implementations of it swapped the VAR and VALUE codes; as RFC 1571 suggests, a
+// list starting with VALUE is taken to be one of those and decoded swapped.
+// ENVIRON has no USERVAR, so every variable is returned with User unset.
+func DecodeLegacy(b []byte) ([]Var, error) {
+	if !Swapped(b) {
+		return Decode(b)
+	}
+	return Decode(swap(b))
+}
+
+// Swapped reports whether an ENVIRON variable list has the VAR and VALUE codes
+// swapped, going by its first code like DecodeLegacy does.
+func Swapped(b []byte) bool {
+	return len(b) > 0 && b[0] == VALUE
+}
+
+// EncodeLegacy returns the variable list for vars in the original ENVIRON option.
+// It has no USERVAR, so every variable is sent as VAR. With swapped set the VAR and
+// VALUE codes are swapped, to answer a peer that sends them that way.
+func EncodeLegacy(swapped bool, vars ...Var) []byte {
+	legacy := make([]Var, len(vars))
+	for i, v := range vars {
+		v.User = false
+		legacy[i] = v
+	}
+	b := Encode(legacy...)
+	if swapped {
+		return swap(b)
+	}
+	return b
+}
+
+// swap returns b with the VAR and VALUE codes swapped, leaving escaped bytes alone.
+func swap(b []byte) []byte {
+	swapped := make([]byte, len(b))
+	for i := 0; i < len(b); i++ {
+		switch b[i] {
+		case VAR:
+			swapped[i] = VALUE
+		case VALUE:
+			swapped[i] = VAR
+		case ESC:
+			swapped[i] = ESC
+			if i+1 < len(b) {
+				i++
+				swapped[i] = b[i]
+			}
+		default:
+			swapped[i] = b[i]
+		}
+	}
+	return swapped
+}
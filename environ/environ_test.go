@@ -0,0 +1,70 @@
+package environ
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	assert.Equal(t, Var{Name: "USER", Value: "bob"}, New(User, "bob"))
+	assert.Equal(t, Var{Name: "TERM", Value: "vt100", User: true}, New("TERM", "vt100"))
+}
+
+func TestEncode(t *testing.T) {
+	b := Encode(New(User, "bob"), New("A\x01B", ""), Var{Name: Display, Unset: true})
+	expected := []byte{VAR, 'U', 'S', 'E', 'R', VALUE, 'b', 'o', 'b',
+		USERVAR, 'A', ESC, 1, 'B', VALUE,
+		VAR, 'D', 'I', 'S', 'P', 'L', 'A', 'Y'}
+	assert.Equal(t, expected, b)
+
+	assert.Equal(t, []byte{VAR, 'J', 'O', 'B', USERVAR, 'X'}, Encode(Names(Job, "X")...))
+}
+
+func TestDecode(t *testing.T) {
+	vars := []Var{
+		New(User, "bob"),
+		New("weird\x00\x02name", "v\x03"),
+		New(Acct, ""),
+		{Name: Printer, Unset: true},
+	}
+	got, err := Decode(Encode(vars...))
+	assert.NoError(t, err)
+	assert.Equal(t, vars, got)
+
+	got, err = Decode(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+
+	_, err = Decode([]byte{VAR, 'A', ESC})
+	assert.Equal(t, ErrTrailingEscape, err)
+	_, err = Decode([]byte{VALUE, 'A'})
+	assert.Error(t, err)
+	_, err = Decode([]byte{'A'})
+	assert.Error(t, err)
+}
+
+func TestDecodeLegacy(t *testing.T) {
+	expected := []Var{New(User, "bob"), New(Printer, "lp\x01")}
+	got, err := DecodeLegacy(Encode(expected...))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, got)
+
+	// VAR and VALUE swapped, as sent by the buggy servers
+	got, err = DecodeLegacy([]byte{VALUE, 'U', 'S', 'E', 'R', VAR, 'b', 'o', 'b', VALUE, 'J', 'O', 'B', VAR, ESC, VAR})
+	assert.NoError(t, err)
+	assert.Equal(t, []Var{New(User, "bob"), New(Job, "\x00")}, got)
+}
+
+func TestEncodeLegacy(t *testing.T) {
+	vars := []Var{New(User, "bob"), New("TERM", "vt100")}
+	// no USERVAR in ENVIRON
+	assert.Equal(t, []byte{VAR, 'U', 'S', 'E', 'R', VALUE, 'b', 'o', 'b', VAR, 'T', 'E', 'R', 'M', VALUE, 'v', 't', '1', '0', '0'}, EncodeLegacy(false, vars...))
+
+	swapped := EncodeLegacy(true, New(Job, "\x01"))
+	assert.Equal(t, []byte{VALUE, 'J', 'O', 'B', VAR, ESC, VALUE}, swapped)
+	assert.True(t, Swapped(swapped))
+	got, err := DecodeLegacy(swapped)
+	assert.NoError(t, err)
+	assert.Equal(t, []Var{New(Job, "\x01")}, got)
+}
@@ -0,0 +1,108 @@
+package gote
+
+import (
+	"fmt"
+
+	"github.com/morganhein/go-telnet/codec"
+)
+
+// maxEvents is the most option changes kept for ReadEvent. Older ones are dropped
+// first, so a connection only read with Read doesn't collect them forever.
+const maxEvents = 256
+
+// Event is an option turning on or off, or a command received from the server,
+// at its place in the data.
+type Event struct {
+	Opt byte
+	// Remote is set for the server's side of the option, as turned on by its WILL,
+	// and unset for the connection's side, as turned on by the server's DO.
+	Remote bool
+	On     bool
+	// Command is set for a command passed on by SetCommandEvents or EventUnknown,
+	// such as EOR or DM, which is in Cmd. The other fields are unused then.
+	Command bool
+	Cmd     byte
+}
+
+func (e Event) String() string {
+	if e.Command {
+		return "command " + codec.CommandName(e.Cmd)
+	}
+	side, state := "local", "off"
+	if e.Remote {
+		side = "remote"
+	}
+	if e.On {
+		state = "on"
+	}
+	return fmt.Sprintf("%s %s %s", side, codec.OptionName(e.Opt), state)
+}
+
+// mark is an Event and how much data came before it.
+type mark struct {
+	at uint64
+	ev Event
+}
+
+// ReadEvent reads like Read, stopping at each option change in the data.
+func (c *conn) ReadEvent(b []byte) (n int, ev *Event, err error) {
+	return c.read(b, true)
+}
+
+// up passes decoded data upstream. The uLock must be held, as it is while parsing.
+func (c *conn) up(b []byte) {
+	c.u.Write(b)
+	c.mLock.Lock()
+	c.delivered += uint64(len(b))
+	c.mLock.Unlock()
+}
+
+// changed records an option change after the data passed upstream so far.
+func (c *conn) changed(opt byte, remote, on bool) {
+	c.event(Event{Opt: opt, Remote: remote, On: on})
+}
+
+// event records ev after the data passed upstream so far.
+func (c *conn) event(ev Event) {
+	c.mLock.Lock()
+	if len(c.marks) == maxEvents {
+		c.marks = c.marks[1:]
+	}
+	c.marks = append(c.marks, mark{at: c.delivered, ev: ev})
+	c.mLock.Unlock()
+	if c.data != nil {
+		notify(c.data)
+	}
+}
+
+// nextEvent returns the oldest change, if there is one.
+func (c *conn) nextEvent() (mark, bool) {
+	c.mLock.Lock()
+	defer c.mLock.Unlock()
+	if len(c.marks) == 0 {
+		return mark{}, false
+	}
+	return c.marks[0], true
+}
+
+// takeEvent removes the oldest change and returns it.
+func (c *conn) takeEvent() *Event {
+	c.mLock.Lock()
+	defer c.mLock.Unlock()
+	ev := c.marks[0].ev
+	c.marks = c.marks[1:]
+	return &ev
+}
+
+// consume counts n bytes taken out of the data, dropping the changes now behind
+// what was read. The uLock must be held.
+func (c *conn) consume(n int) {
+	c.consumed += uint64(n)
+	c.mLock.Lock()
+	i := 0
+	for i < len(c.marks) && c.marks[i].at < c.consumed {
+		i++
+	}
+	c.marks = c.marks[i:]
+	c.mLock.Unlock()
+}
@@ -0,0 +1,71 @@
+package gote
+
+import (
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadEvent(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	// the whole prompt arrives in one segment, the change must still land between the two parts
+	stream := append([]byte("login: bob\r\n"), IAC, WILL, ECHO)
+	stream = append(stream, "Password: "...)
+	err := server.Play(time.Second, fake.Step{Send: stream, Expect: []byte{IAC, DO, ECHO}})
+	assert.NoError(t, err)
+
+	b := make([]byte, 64)
+	var got []interface{}
+	for len(got) < 3 {
+		tel.SetReadDeadline(time.Now().Add(time.Second))
+		n, ev, err := tel.ReadEvent(b)
+		if !assert.NoError(t, err) {
+			return
+		}
+		if ev != nil {
+			got = append(got, *ev)
+		} else {
+			got = append(got, string(b[:n]))
+		}
+	}
+	assert.Equal(t, []interface{}{"login: bob\r\n", Event{Opt: ECHO, Remote: true, On: true}, "Password: "}, got)
+	assert.Equal(t, "remote ECHO on", Event{Opt: ECHO, Remote: true, On: true}.String())
+}
+
+func TestReadEvent_Read(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	// Read goes straight past the changes
+	stream := append([]byte("one "), IAC, WILL, ECHO)
+	stream = append(stream, "two"...)
+	err := server.Play(time.Second, fake.Step{Send: stream, Expect: []byte{IAC, DO, ECHO}})
+	assert.NoError(t, err)
+
+	b := make([]byte, 64)
+	tel.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := tel.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "one two", string(b[:n]))
+
+	// and drops them once the data around them was read
+	err = server.Play(time.Second, fake.Step{Send: append([]byte{IAC, WONT, ECHO}, "three"...), Expect: []byte{IAC, DONT, ECHO}})
+	assert.NoError(t, err)
+	tel.SetReadDeadline(time.Now().Add(time.Second))
+	n, ev, err := tel.ReadEvent(b)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, &Event{Opt: ECHO, Remote: true, On: false}, ev)
+	n, ev, err = tel.ReadEvent(b)
+	assert.NoError(t, err)
+	assert.Nil(t, ev)
+	assert.Equal(t, "three", string(b[:n]))
+}
@@ -1,20 +1,149 @@
 package gote_test
 
-import "github.com/morganhein/go-telnet"
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+
+	"github.com/morganhein/go-telnet"
+	"github.com/morganhein/go-telnet/codec"
+)
+
+// server handles the first connection to a local listener, and returns its address.
+func server(handle func(c net.Conn)) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		defer l.Close()
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		handle(c)
+	}()
+	return l.Addr().String()
+}
 
 func ExampleDial() {
+	addr := server(func(c net.Conn) {
+		// offer Suppress-Go-Ahead, then greet
+		c.Write([]byte{gote.IAC, gote.WILL, gote.SGA})
+		c.Write([]byte("Welcome!\r\n"))
+		io.Copy(ioutil.Discard, c)
+	})
+
 	// Dial the telnet server
-	conn, err := gote.Dial("tcp", "rainmaker.wunderground.com")
+	conn, err := gote.Dial("tcp", addr)
 	if err != nil {
 		panic("Unable to connect.")
 	}
-	// Read 30 bytes from the stream
-	buf := make([]byte, 30)
-	_, err = conn.Read(buf)
+	defer conn.Close()
+	// Negotiation is handled by the connection, only the text is read
+	line, _, err := gote.NewLineReader(conn).ReadLine()
 	if err != nil {
 		panic("Unable to read from stream.")
 	}
+	fmt.Println(line)
+	// Output: Welcome!
+}
+
+func ExampleListen() {
+	l, err := gote.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		line, _, _ := gote.NewLineReader(c).ReadLine()
+		fmt.Fprintf(c, "you said %q\r\n", line)
+	}()
+
+	conn, err := gote.Dial("tcp", l.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello\r\n"))
+	line, _, _ := gote.NewLineReader(conn).ReadLine()
+	fmt.Println(line)
+	// Output: you said "hello"
+}
+
+// gmcp takes the server's offer of GMCP (option 201) and collects its messages.
+type gmcp struct {
+	gote.BaseOption
+	messages chan string
+}
+
+func (g *gmcp) Accept(cmd byte) bool {
+	return cmd == gote.WILL
+}
+
+func (g *gmcp) Subnegotiation(c gote.Connection, payload []byte) error {
+	g.messages <- string(payload)
+	return nil
+}
+
+func ExampleConnection_RegisterOption() {
+	addr := server(func(c net.Conn) {
+		r := bufio.NewReader(c)
+		// wait for the player's name before starting
+		r.ReadString('\n')
+		c.Write([]byte{gote.IAC, gote.WILL, 201})
+		// the client agrees with IAC DO GMCP
+		io.ReadFull(r, make([]byte, 3))
+		c.Write(append(append([]byte{gote.IAC, gote.SB, 201}, `Char.Vitals {"hp":10}`...), gote.IAC, gote.SE))
+		io.Copy(ioutil.Discard, r)
+	})
+
+	conn, err := gote.Dial("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+	g := &gmcp{messages: make(chan string, 1)}
+	conn.RegisterOption(201, g)
+	conn.Write([]byte("gandalf\r\n"))
+	fmt.Println(<-g.messages)
+	// Output: Char.Vitals {"hp":10}
+}
 
-	// Write 'Hello World' to the stream.
-	_, err = conn.Write([]byte("Hello world!"))
+func ExampleConnection_SetTerminalType() {
+	done := make(chan struct{})
+	addr := server(func(c net.Conn) {
+		defer close(done)
+		c.Write([]byte{gote.IAC, gote.DO, gote.TTYPE})
+		c.Write(gote.Subnegotiation(gote.TTYPE, gote.SEND, nil))
+		// show what the client answered
+		t := codec.Tokenize(c)
+		for i := 0; i < 2; i++ {
+			tok, err := t.Next()
+			if err != nil {
+				return
+			}
+			fmt.Println(tok)
+		}
+	})
+
+	// set on the Dialer, so it is in place for the server's first request
+	d := gote.Dialer{TerminalType: []string{"VT100"}}
+	conn, err := d.Dial("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+	<-done
+	// Output:
+	// IAC WILL TTYPE
+	// IAC SB TTYPE 00 56 54 31 30 30 IAC SE
 }
@@ -0,0 +1,267 @@
+// Package fake provides an in-memory net.Conn for testing code built on gote (go-telnet),
+// without a network or external mocking dependencies.
+package fake
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Conn is one end of an in-memory connection created by Pipe. Unlike net.Pipe, writes
+// are buffered and never wait for the peer to read, and each Write is delivered to the
+// peer as its own segment: a single Read never returns bytes from two different writes.
+// This makes it possible to script exactly how a stream is split up.
+// Read and write deadlines behave like they do on a TCP connection.
+type Conn struct {
+	r     *pipe // read from
+	w     *pipe // written to
+	local net.Addr
+	peer  net.Addr
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+	closed        bool
+}
+
+// Pipe creates a connected pair of in-memory connections.
+func Pipe() (client *Conn, server *Conn) {
+	a, b := newPipe(), newPipe()
+	client = &Conn{r: a, w: b, local: Addr("client"), peer: Addr("server")}
+	server = &Conn{r: b, w: a, local: Addr("server"), peer: Addr("client")}
+	return client, server
+}
+
+// Read reads from the oldest unread segment written by the peer. It blocks until
+// data is available, the peer closes the connection, or the read deadline passes.
+func (c *Conn) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		closed, deadline := c.closed, c.readDeadline
+		c.mu.Unlock()
+		if closed {
+			return 0, io.ErrClosedPipe
+		}
+
+		n, ok, wait := c.r.read(b)
+		if ok {
+			return n, nil
+		}
+		if wait == nil {
+			return 0, io.EOF
+		}
+
+		if deadline.IsZero() {
+			<-wait
+			continue
+		}
+		d := deadline.Sub(time.Now())
+		if d <= 0 {
+			return 0, timeoutError{}
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-wait:
+			t.Stop()
+		case <-t.C:
+			return 0, timeoutError{}
+		}
+	}
+}
+
+// Write queues b as a single segment for the peer to read. It does not block.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	closed, deadline := c.closed, c.writeDeadline
+	c.mu.Unlock()
+	if closed {
+		return 0, io.ErrClosedPipe
+	}
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return 0, timeoutError{}
+	}
+	if !c.w.write(b) {
+		return 0, io.ErrClosedPipe
+	}
+	return len(b), nil
+}
+
+// Close closes the connection. The peer can still read what was written before
+// Close, after which its reads return io.EOF.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return io.ErrClosedPipe
+	}
+	c.closed = true
+	c.mu.Unlock()
+	c.w.close()
+	c.r.close()
+	return nil
+}
+
+// LocalAddr returns the address of this end of the pipe.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// RemoteAddr returns the address of the other end of the pipe.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.peer
+}
+
+// SetDeadline sets both the read and write deadlines.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline. Blocked reads pick up the new deadline.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	c.r.wake()
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+// Expect reads exactly len(b) bytes, across as many segments as needed, and returns
+// an error if they differ from b or don't all arrive within timeout.
+func (c *Conn) Expect(b []byte, timeout time.Duration) error {
+	c.SetReadDeadline(time.Now().Add(timeout))
+	defer c.SetReadDeadline(time.Time{})
+	got := make([]byte, len(b))
+	n, err := io.ReadFull(c, got)
+	if err != nil {
+		return fmt.Errorf("expected %v, got %v: %v", b, got[:n], err)
+	}
+	if !bytes.Equal(b, got) {
+		return fmt.Errorf("expected %v, got %v", b, got)
+	}
+	return nil
+}
+
+// Step is a single step of a script played against a connection.
+type Step struct {
+	// Send is written to the connection as a single segment, if not empty.
+	Send []byte
+	// Expect must be read from the connection after Send, if not empty.
+	Expect []byte
+}
+
+// Play runs the steps in order, giving each expectation up to timeout to arrive,
+// and stops at the first failing step.
+func (c *Conn) Play(timeout time.Duration, steps ...Step) error {
+	for i, s := range steps {
+		if len(s.Send) > 0 {
+			if _, err := c.Write(s.Send); err != nil {
+				return fmt.Errorf("step %d: %v", i, err)
+			}
+		}
+		if len(s.Expect) > 0 {
+			if err := c.Expect(s.Expect, timeout); err != nil {
+				return fmt.Errorf("step %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Addr is the address of a fake connection.
+type Addr string
+
+// Network returns "fake".
+func (a Addr) Network() string {
+	return "fake"
+}
+
+func (a Addr) String() string {
+	return string(a)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// pipe is a one directional queue of segments.
+type pipe struct {
+	mu     sync.Mutex
+	segs   [][]byte
+	closed bool
+	// signal is closed and replaced whenever the pipe changes.
+	signal chan struct{}
+}
+
+func newPipe() *pipe {
+	return &pipe{signal: make(chan struct{})}
+}
+
+// read copies from the first segment. If nothing is available it returns a channel
+// that is closed on the next change, or nil if the pipe is closed and drained.
+func (p *pipe) read(b []byte) (n int, ok bool, wait <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.segs) == 0 {
+		if p.closed {
+			return 0, false, nil
+		}
+		return 0, false, p.signal
+	}
+	n = copy(b, p.segs[0])
+	if n == len(p.segs[0]) {
+		p.segs = p.segs[1:]
+	} else {
+		p.segs[0] = p.segs[0][n:]
+	}
+	return n, true, nil
+}
+
+func (p *pipe) write(b []byte) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	if len(b) > 0 {
+		seg := make([]byte, len(b))
+		copy(seg, b)
+		p.segs = append(p.segs, seg)
+	}
+	p.notify()
+	return true
+}
+
+func (p *pipe) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		p.notify()
+	}
+}
+
+func (p *pipe) wake() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.notify()
+}
+
+func (p *pipe) notify() {
+	close(p.signal)
+	p.signal = make(chan struct{})
+}
@@ -0,0 +1,80 @@
+package fake
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var _ net.Conn = &Conn{}
+
+func TestPipe_Segments(t *testing.T) {
+	client, server := Pipe()
+	client.Write([]byte{1, 2, 3})
+	client.Write([]byte{4, 5})
+
+	b := make([]byte, 10)
+	n, err := server.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, b[:n])
+	n, err = server.Read(b[:1])
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{4}, b[:n])
+	n, err = server.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{5}, b[:n])
+}
+
+func TestPipe_Close(t *testing.T) {
+	client, server := Pipe()
+	client.Write([]byte("bye"))
+	assert.NoError(t, client.Close())
+
+	b := make([]byte, 10)
+	n, err := server.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "bye", string(b[:n]))
+	_, err = server.Read(b)
+	assert.Equal(t, io.EOF, err)
+	_, err = server.Write(b)
+	assert.Error(t, err)
+	_, err = client.Read(b)
+	assert.Equal(t, io.ErrClosedPipe, err)
+}
+
+func TestPipe_ReadDeadline(t *testing.T) {
+	client, _ := Pipe()
+	client.SetReadDeadline(time.Now().Add(time.Duration(10) * time.Millisecond))
+	_, err := client.Read(make([]byte, 1))
+	nerr, ok := err.(net.Error)
+	assert.True(t, ok)
+	assert.True(t, nerr.Timeout())
+
+	// a deadline set while a read is blocked still applies
+	client.SetReadDeadline(time.Time{})
+	go func() {
+		time.Sleep(time.Duration(10) * time.Millisecond)
+		client.SetReadDeadline(time.Now())
+	}()
+	_, err = client.Read(make([]byte, 1))
+	nerr, ok = err.(net.Error)
+	assert.True(t, ok)
+	assert.True(t, nerr.Timeout())
+}
+
+func TestPlay(t *testing.T) {
+	client, server := Pipe()
+	go func() {
+		b := make([]byte, 5)
+		io.ReadFull(server, b)
+		server.Write([]byte("world"))
+	}()
+	err := client.Play(time.Second, Step{Send: []byte("hello"), Expect: []byte("world")})
+	assert.NoError(t, err)
+
+	err = client.Play(time.Duration(10)*time.Millisecond, Step{Expect: []byte("more")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+//go:build go1.23
+// +build go1.23
+
+package gote
+
+import (
+	"bytes"
+	"io"
+	"iter"
+)
+
+// Lines returns an iterator over the lines read from r, usually a Connection, for use
+// with range. Lines are split like LineReader splits them, and a final line without
+// a terminator is yielded as well. If reading fails with anything other than io.EOF,
+// the last pair yielded carries the error. r is read ahead, so what was read past the
+// line yielded last is lost when breaking out of the loop; to carry on reading
+// afterwards, range over the Lines of a LineReader instead.
+//
+//	for line, err := range gote.Lines(conn) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(line)
+//	}
+func Lines(r io.Reader) iter.Seq2[string, error] {
+	return NewLineReader(r).Lines()
+}
+
+// Lines returns an iterator over the lines ReadLine returns, like the package level
+// Lines. Data read ahead stays in the LineReader when breaking out of the loop, so
+// ranging over Lines again, or calling ReadLine, carries on from the next line.
+func (l *LineReader) Lines() iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for {
+			line, _, err := l.ReadLine()
+			if err == io.EOF {
+				return
+			}
+			if !yield(line, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Messages returns an iterator over the messages read from r that are separated by delim,
+// such as a prompt. Messages are yielded without the delimiter, and trailing data
+// without a delimiter is yielded when the stream ends. Errors are reported like Lines,
+// and like Lines, r is read ahead; range over the Messages of a LineReader to carry
+// on reading after breaking out of the loop.
+func Messages(r io.Reader, delim []byte) iter.Seq2[[]byte, error] {
+	return NewLineReader(r).Messages(delim)
+}
+
+// Messages returns an iterator over the messages separated by delim, like the
+// package level Messages, reading from where ReadLine left off. Data read ahead
+// stays in the LineReader when breaking out of the loop. MaxLength and Timeout
+// don't apply to messages.
+func (l *LineReader) Messages(delim []byte) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		if l.closed {
+			yield(nil, io.ErrClosedPipe)
+			return
+		}
+		for {
+			if i := bytes.Index(l.pending, delim); len(delim) > 0 && i >= 0 {
+				msg := append([]byte(nil), l.pending[:i]...)
+				l.pending = l.pending[i+len(delim):]
+				if !yield(msg, nil) {
+					return
+				}
+				continue
+			}
+			if l.err != nil {
+				if len(l.pending) > 0 {
+					msg := append([]byte(nil), l.pending...)
+					l.pending = nil
+					if !yield(msg, nil) {
+						return
+					}
+				}
+				if l.err != io.EOF {
+					yield(nil, l.err)
+				}
+				return
+			}
+			l.more()
+		}
+	}
+}
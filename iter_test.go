@@ -0,0 +1,98 @@
+//go:build go1.23
+// +build go1.23
+
+package gote
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLines(t *testing.T) {
+	var lines []string
+	for line, err := range Lines(strings.NewReader("one\r\ntwo\nthree")) {
+		assert.NoError(t, err)
+		lines = append(lines, line)
+	}
+	assert.Equal(t, []string{"one", "two", "three"}, lines)
+}
+
+func TestLines_Error(t *testing.T) {
+	failed := errors.New("failed")
+	r := io.MultiReader(strings.NewReader("one\n"), &errReader{failed})
+	var lines []string
+	var last error
+	for line, err := range Lines(r) {
+		lines = append(lines, line)
+		last = err
+	}
+	assert.Equal(t, []string{"one", ""}, lines)
+	assert.Equal(t, failed, last)
+}
+
+func TestLines_Break(t *testing.T) {
+	l := NewLineReader(strings.NewReader("one\r\ntwo\r\nthree"))
+	for line := range l.Lines() {
+		assert.Equal(t, "one", line)
+		break
+	}
+	// what was read ahead is still there
+	var lines []string
+	for line := range l.Lines() {
+		lines = append(lines, line)
+	}
+	assert.Equal(t, []string{"two", "three"}, lines)
+}
+
+func TestMessages(t *testing.T) {
+	var msgs []string
+	for msg, err := range Messages(strings.NewReader("show ver\r\nv1\r\nrouter# show int\r\nrouter# "), []byte("router# ")) {
+		assert.NoError(t, err)
+		msgs = append(msgs, string(msg))
+	}
+	assert.Equal(t, []string{"show ver\r\nv1\r\n", "show int\r\n"}, msgs)
+
+	// stopping early is fine, and a LineReader carries on from there
+	l := NewLineReader(strings.NewReader("a;b;c"))
+	for range l.Messages([]byte(";")) {
+		break
+	}
+	msgs = nil
+	for msg := range l.Messages([]byte(";")) {
+		msgs = append(msgs, string(msg))
+	}
+	assert.Equal(t, []string{"b", "c"}, msgs)
+}
+
+func TestLines_Reads(t *testing.T) {
+	r := &countingReader{r: strings.NewReader(strings.Repeat("line\r\n", 100))}
+	n := 0
+	for range Lines(r) {
+		n++
+	}
+	assert.Equal(t, 100, n)
+	// read in chunks, not a byte at a time
+	assert.True(t, r.reads < 10, "%d reads", r.reads)
+}
+
+type countingReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	r.reads++
+	return r.r.Read(b)
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(b []byte) (int, error) {
+	return 0, r.err
+}
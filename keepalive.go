@@ -0,0 +1,190 @@
+package gote
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNoTimingMark is returned by Ping, and fails a connection kept alive with
+// timing marks, when the server doesn't answer a timing mark in time.
+var ErrNoTimingMark = errors.New("gote: no answer to timing mark")
+
+// Probe is what a keepalive sends.
+type Probe int
+
+const (
+	// ProbeNOP sends IAC NOP, which servers silently drop.
+	ProbeNOP Probe = iota
+	// ProbeAYT sends IAC AYT. Servers answer with some text, which arrives as data.
+	ProbeAYT
+	// ProbeTimingMark sends IAC DO TIMING-MARK, which servers must answer, so
+	// a missing answer fails the connection with ErrNoTimingMark.
+	ProbeTimingMark
+)
+
+// Keepalive says how an idle connection keeps itself alive.
+type Keepalive struct {
+	// Interval is how long the connection may receive nothing before a probe is
+	// sent. Zero disables keepalives, which is the default.
+	Interval time.Duration
+	Probe    Probe
+	// Timeout is how long a timing mark may go unanswered. Zero means Interval.
+	Timeout time.Duration
+}
+
+// tmState tracks the timing marks sent and not answered yet.
+type tmState struct {
+	// send is held from queueing a waiter until its timing mark is sent, so the
+	// waiters are in the order of the marks
+	send sync.Mutex
+	mu   sync.Mutex
+	// waiters wait for the answers, in order, with nil for the keepalive's own
+	waiters []chan struct{}
+	// probe is when the keepalive's own timing mark was sent, if it is outstanding
+	probe time.Time
+}
+
+// SetKeepalive sets how the connection keeps itself alive while idle.
+func (c *conn) SetKeepalive(k Keepalive) {
+	c.cLock.Lock()
+	c.keep = k
+	c.cLock.Unlock()
+	if c.wake != nil {
+		notify(c.wake)
+	}
+}
+
+// Ping sends a timing mark and waits for the answer.
+func (c *conn) Ping(timeout time.Duration) error {
+	ch := make(chan struct{})
+	c.tm.send.Lock()
+	c.tm.mu.Lock()
+	c.tm.waiters = append(c.tm.waiters, ch)
+	c.tm.mu.Unlock()
+	err := c.send([]byte{IAC, DO, TM})
+	c.tm.send.Unlock()
+	if err != nil {
+		c.forget(ch)
+		return err
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-ch:
+		return nil
+	case <-c.done:
+		c.forget(ch)
+		return c.Err()
+	case <-t.C:
+		c.forget(ch)
+		return ErrNoTimingMark
+	}
+}
+
+// forget stops waiting for an answer to a timing mark that was given up on.
+// The answer may still arrive, and is consumed as belonging to the next one.
+func (c *conn) forget(ch chan struct{}) {
+	c.tm.mu.Lock()
+	defer c.tm.mu.Unlock()
+	for i, w := range c.tm.waiters {
+		if w == ch {
+			c.tm.waiters = append(c.tm.waiters[:i], c.tm.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// timingMark takes a WILL or WONT TIMING-MARK received from the server as the
+// answer to the oldest outstanding timing mark, whether Ping or the keepalive sent
+// it, and reports whether there was one.
+func (c *conn) timingMark() bool {
+	c.tm.mu.Lock()
+	defer c.tm.mu.Unlock()
+	if len(c.tm.waiters) == 0 {
+		return false
+	}
+	if w := c.tm.waiters[0]; w != nil {
+		close(w)
+	} else {
+		c.tm.probe = time.Time{}
+	}
+	c.tm.waiters = c.tm.waiters[1:]
+	return true
+}
+
+// keepaliveDue returns how long until keepalive has something to do, or -1 if
+// keepalives are off.
+func (c *conn) keepaliveDue(now time.Time) time.Duration {
+	c.cLock.Lock()
+	k := c.keep
+	c.cLock.Unlock()
+	if k.Interval <= 0 {
+		return -1
+	}
+	timeout := k.Timeout
+	if timeout <= 0 {
+		timeout = k.Interval
+	}
+	c.tm.mu.Lock()
+	probe := c.tm.probe
+	c.tm.mu.Unlock()
+	at := c.lastInput.Add(k.Interval)
+	if !probe.IsZero() {
+		at = probe.Add(timeout)
+	}
+	if d := at.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// keepalive sends a probe once the connection has been idle for the keepalive
+// interval, and fails it if a timing mark wasn't answered in time.
+// It is called from the processing goroutine.
+func (c *conn) keepalive(now time.Time) {
+	c.cLock.Lock()
+	k := c.keep
+	c.cLock.Unlock()
+	if k.Interval <= 0 {
+		return
+	}
+	timeout := k.Timeout
+	if timeout <= 0 {
+		timeout = k.Interval
+	}
+
+	c.tm.mu.Lock()
+	probe := c.tm.probe
+	c.tm.mu.Unlock()
+	if !probe.IsZero() {
+		if now.Sub(probe) >= timeout {
+			c.fail(ErrNoTimingMark)
+		}
+		return
+	}
+	if now.Sub(c.lastInput) < k.Interval {
+		return
+	}
+
+	var b []byte
+	switch k.Probe {
+	case ProbeAYT:
+		b = []byte{IAC, AYT}
+	case ProbeTimingMark:
+		c.tm.send.Lock()
+		defer c.tm.send.Unlock()
+		c.tm.mu.Lock()
+		c.tm.probe = now
+		c.tm.waiters = append(c.tm.waiters, nil)
+		c.tm.mu.Unlock()
+		b = []byte{IAC, DO, TM}
+	default:
+		b = []byte{IAC, NOP}
+	}
+	// count the probe as activity, so the next one waits a full interval
+	c.lastInput = now
+	if err := c.send(b); err != nil {
+		c.fail(err)
+	}
+}
@@ -0,0 +1,100 @@
+package gote
+
+import (
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPing(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	go func() {
+		if server.Expect([]byte{IAC, DO, TM}, time.Second) == nil {
+			server.Write([]byte{IAC, WONT, TM, 'x'})
+		}
+	}()
+	assert.NoError(t, tel.Ping(time.Second))
+	// the answer itself isn't answered
+	b := make([]byte, 1)
+	_, err := ReadFull(tel, b)
+	assert.NoError(t, err)
+	server.SetReadDeadline(time.Now().Add(time.Duration(200) * time.Millisecond))
+	_, err = server.Read(b)
+	assert.Error(t, err)
+	server.SetReadDeadline(time.Time{})
+
+	assert.Equal(t, ErrNoTimingMark, tel.Ping(time.Duration(50)*time.Millisecond))
+	assert.NoError(t, server.Expect([]byte{IAC, DO, TM}, time.Second))
+
+	// an unsolicited WILL TIMING-MARK is refused as usual
+	server.Write([]byte{IAC, WILL, TM, IAC, WILL, TM})
+	assert.NoError(t, server.Expect([]byte{IAC, DONT, TM}, time.Second))
+}
+
+func TestKeepalive(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.SetKeepalive(Keepalive{Interval: time.Duration(50) * time.Millisecond})
+	tel.start(client)
+	defer tel.Close()
+	assert.NoError(t, server.Expect([]byte{IAC, NOP}, time.Second))
+
+	tel.SetKeepalive(Keepalive{
+		Interval: time.Duration(50) * time.Millisecond,
+		Probe:    ProbeTimingMark,
+		Timeout:  time.Duration(100) * time.Millisecond,
+	})
+	// a first probe is answered, the second isn't
+	assert.NoError(t, server.Expect([]byte{IAC, DO, TM}, time.Second))
+	server.Write([]byte{IAC, WILL, TM})
+	assert.NoError(t, server.Expect([]byte{IAC, DO, TM}, time.Second))
+	select {
+	case <-tel.Done():
+	case <-time.After(time.Second):
+		t.Fatal("connection wasn't failed")
+	}
+	assert.Equal(t, ErrNoTimingMark, tel.Err())
+}
+
+func TestKeepalive_PingOrder(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.SetKeepalive(Keepalive{
+		Interval: time.Duration(100) * time.Millisecond,
+		Probe:    ProbeTimingMark,
+		Timeout:  time.Second,
+	})
+	tel.start(client)
+	defer tel.Close()
+
+	pinged := make(chan error, 1)
+	go func() {
+		pinged <- tel.Ping(time.Second)
+	}()
+	// the Ping goes out first, then the probe once the connection is idle
+	assert.NoError(t, server.Expect([]byte{IAC, DO, TM}, time.Second))
+	assert.NoError(t, server.Expect([]byte{IAC, DO, TM}, time.Second))
+	// so the first answer is the Ping's
+	server.Write([]byte{IAC, WILL, TM})
+	assert.NoError(t, <-pinged)
+	// and the second the probe's
+	server.Write([]byte{IAC, WILL, TM})
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		tel.tm.mu.Lock()
+		left, probe := len(tel.tm.waiters), tel.tm.probe
+		tel.tm.mu.Unlock()
+		if left == 0 {
+			assert.True(t, probe.IsZero())
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the probe wasn't answered")
+		}
+	}
+}
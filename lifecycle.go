@@ -0,0 +1,63 @@
+package gote
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrClosed is returned by Read and Err once the connection has been closed with Close.
+var ErrClosed = errors.New("gote: connection closed")
+
+// Run starts the connection's background goroutines. Done is closed once all of
+// them have returned, after the exit hook, if any, has run.
+func (c *conn) run(fs ...func()) {
+	atomic.AddInt32(&c.running, int32(len(fs)))
+	for _, f := range fs {
+		go func(f func()) {
+			defer func() {
+				if atomic.AddInt32(&c.running, -1) == 0 {
+					if c.exited != nil {
+						c.exited()
+					}
+					close(c.done)
+				}
+			}()
+			f()
+		}(f)
+	}
+}
+
+// Stop ends the connection on its first failure, or on Close: it cancels the
+// connection context, which stops the processing goroutine, and closes the
+// underlying connection, which stops the reading goroutine.
+func (c *conn) stop(err error) {
+	c.stopOnce.Do(func() {
+		c.err = err
+		if c.failed != nil {
+			close(c.failed)
+		}
+		// connections that were never started have nothing to stop
+		if c.cancel != nil {
+			c.cancel()
+		}
+		if c.Conn != nil {
+			c.closeErr = c.Conn.Close()
+		}
+	})
+}
+
+// Done returns a channel that is closed once the connection has ended and
+// its goroutines have exited.
+func (c *conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, or nil if it hasn't yet.
+func (c *conn) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,47 @@
+package gote
+
+import "time"
+
+// Negotiation replies are capped per option, so a peer flooding WILL/DO requests
+// can't turn the connection into an amplifier. Requests over the cap are consumed
+// without a reply. Subnegotiation sent by option handlers counts towards the same
+// cap, as it mostly answers requests from the peer. Dialer.MaxReplies and
+// Listener.MaxReplies change the cap from the default.
+const (
+	defaultMaxReplies = 10
+	maxRepliesSpan    = time.Second
+)
+
+// replyLimit counts the replies sent for one option in the current span.
+type replyLimit struct {
+	start time.Time
+	count int
+}
+
+// allow reports whether another reply may be sent for opt right now.
+func (c *conn) allow(opt byte) bool {
+	max := c.maxReplies
+	switch {
+	case max < 0:
+		return true
+	case max == 0:
+		max = defaultMaxReplies
+	}
+	c.lLock.Lock()
+	defer c.lLock.Unlock()
+	if c.limits == nil {
+		c.limits = make(map[byte]*replyLimit)
+	}
+	now := time.Now()
+	l, ok := c.limits[opt]
+	if !ok || now.Sub(l.start) >= maxRepliesSpan {
+		c.limits[opt] = &replyLimit{start: now, count: 1}
+		return true
+	}
+	if l.count >= max {
+		c.countOption(opt, OptionStats{Dropped: 1})
+		return false
+	}
+	l.count++
+	return true
+}
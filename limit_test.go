@@ -0,0 +1,77 @@
+package gote
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplyLimit(t *testing.T) {
+	tel := &conn{
+		i: bytes.NewBuffer(nil),
+		u: bytes.NewBuffer(nil),
+	}
+	for i := 0; i < defaultMaxReplies*2; i++ {
+		tel.i.Write([]byte{IAC, DO, ECHO, IAC, DO, SGA})
+	}
+	tel.parse()
+	assert.Equal(t, 0, tel.i.Len())
+	// each option is capped on its own
+	assert.Equal(t, defaultMaxReplies*2*3, len(tel.replies))
+
+	// the cap resets after the span
+	tel.limits[ECHO].start = tel.limits[ECHO].start.Add(-maxRepliesSpan)
+	tel.i.Write([]byte{IAC, DO, ECHO})
+	tel.parse()
+	assert.Equal(t, (defaultMaxReplies*2+1)*3, len(tel.replies))
+}
+
+func TestReplyLimit_State(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{
+		Conn: client,
+		i:    bytes.NewBuffer(nil),
+		u:    bytes.NewBuffer(nil),
+	}
+	tel.SetWindowSize(80, 24)
+	for i := 0; i < defaultMaxReplies; i++ {
+		tel.i.Write([]byte{IAC, DO, NAWS, IAC, DONT, NAWS})
+	}
+	tel.parse()
+	tel.callbacks()
+	tel.flush()
+	// the requests past the cap left NAWS off, without a reply or a size
+	assert.Equal(t, optSides(0), tel.enabled[NAWS])
+	client.Close()
+	out, _ := ioutil.ReadAll(server)
+	wills := bytes.Count(out, []byte{IAC, WILL, NAWS})
+	sizes := bytes.Count(out, []byte{IAC, SB, NAWS})
+	wonts := bytes.Count(out, []byte{IAC, WONT, NAWS})
+	assert.Equal(t, wills, wonts)
+	// the sizes share the cap, and the handler only sends them once the flood was
+	// answered, so they can be left out
+	assert.True(t, sizes <= wills, "%d sizes for %d WILL NAWS", sizes, wills)
+	assert.Equal(t, defaultMaxReplies, wills+sizes+wonts)
+}
+
+func TestReplyLimit_Max(t *testing.T) {
+	for _, max := range []int{20, -1} {
+		tel := &conn{
+			i:          bytes.NewBuffer(nil),
+			u:          bytes.NewBuffer(nil),
+			maxReplies: max,
+		}
+		for i := 0; i < 30; i++ {
+			tel.i.Write([]byte{IAC, DO, ECHO})
+		}
+		tel.parse()
+		want := 30
+		if max > 0 {
+			want = max
+		}
+		assert.Equal(t, want*3, len(tel.replies), "max %d", max)
+	}
+}
@@ -0,0 +1,209 @@
+package gote
+
+import (
+	"io"
+	"time"
+)
+
+// LineReader assembles text lines from a decoded telnet stream, such as a Connection.
+// Lines may be terminated by CR LF, CR NUL, a bare LF or a bare CR, and are returned
+// without their terminator.
+type LineReader struct {
+	// MaxLength is the longest line returned in one piece. Longer lines are split
+	// and returned as partial lines. Zero means no limit.
+	MaxLength int
+	// Timeout is how long a partially received line may sit without new data before
+	// it is flushed as a partial line, mainly for prompts that never end in a newline.
+	// Zero means wait forever.
+	Timeout time.Duration
+
+	r       io.Reader
+	size    int    // of each read from r
+	buf     []byte // read into, in two halves the background goroutine takes turns with
+	chunks  chan chunk
+	quit    chan struct{}
+	pending []byte
+	err     error
+	started bool
+	closed  bool
+	// skip is set when a line was flushed on a bare CR, so a late LF or NUL
+	// belonging to the same terminator is not returned as an empty line.
+	skip bool
+}
+
+type chunk struct {
+	b   []byte
+	err error
+}
+
+// NewLineReader returns a LineReader reading from r.
+func NewLineReader(r io.Reader) *LineReader {
+	return &LineReader{
+		r:      r,
+		size:   512,
+		chunks: make(chan chunk),
+		quit:   make(chan struct{}),
+	}
+}
+
+// ReadLine returns the next line from the stream. isPartial is true when the line
+// was split because it exceeded MaxLength, was flushed by Timeout, or was cut short
+// by the end of the stream. Once the stream fails, any pending data is returned first
+// and the error is returned on the following call. After Close it returns io.ErrClosedPipe.
+// With a Timeout, the underlying reader is consumed by a background goroutine, which
+// exits once the reader returns an error or the LineReader is closed.
+func (l *LineReader) ReadLine() (line string, isPartial bool, err error) {
+	if l.closed {
+		return "", false, io.ErrClosedPipe
+	}
+	for {
+		if line, isPartial, ok := l.next(); ok {
+			return line, isPartial, nil
+		}
+		if l.err != nil {
+			if len(l.pending) > 0 {
+				return l.flush()
+			}
+			return "", false, l.err
+		}
+		if l.Timeout <= 0 && !l.started {
+			l.receive(l.read())
+			continue
+		}
+		if !l.started {
+			l.started = true
+			go l.fill()
+		}
+		if l.Timeout <= 0 || len(l.pending) == 0 {
+			l.receive(<-l.chunks)
+			continue
+		}
+		t := time.NewTimer(l.Timeout)
+		select {
+		case c := <-l.chunks:
+			t.Stop()
+			l.receive(c)
+		case <-t.C:
+			return l.flush()
+		}
+	}
+}
+
+// more waits for the next chunk from the underlying reader, from the background
+// goroutine if ReadLine started it.
+func (l *LineReader) more() {
+	if l.started {
+		l.receive(<-l.chunks)
+		return
+	}
+	l.receive(l.read())
+}
+
+func (l *LineReader) receive(c chunk) {
+	l.pending = append(l.pending, c.b...)
+	l.err = c.err
+}
+
+// next extracts a line from the pending buffer if one is available.
+func (l *LineReader) next() (string, bool, bool) {
+	if l.skip && len(l.pending) > 0 {
+		l.skip = false
+		if l.pending[0] == '\n' || l.pending[0] == 0 {
+			l.pending = l.pending[1:]
+		}
+	}
+	for i, b := range l.pending {
+		switch b {
+		case '\n':
+			return l.consume(i, i+1), false, true
+		case '\r':
+			// wait for the next byte to find out how long the terminator is
+			if i+1 == len(l.pending) {
+				return "", false, false
+			}
+			if n := l.pending[i+1]; n == '\n' || n == 0 {
+				return l.consume(i, i+2), false, true
+			}
+			return l.consume(i, i+1), false, true
+		}
+		if l.MaxLength > 0 && i >= l.MaxLength {
+			return l.consume(l.MaxLength, l.MaxLength), true, true
+		}
+	}
+	return "", false, false
+}
+
+// flush returns everything pending. A trailing CR still counts as a complete line.
+func (l *LineReader) flush() (string, bool, error) {
+	n := len(l.pending)
+	if l.pending[n-1] == '\r' {
+		l.skip = true
+		return l.consume(n-1, n), false, nil
+	}
+	return l.consume(n, n), true, nil
+}
+
+// consume returns the first end bytes of the pending buffer as a line,
+// and drops the first n bytes. Once all of it is consumed, the buffer is
+// reused from the start.
+func (l *LineReader) consume(end, n int) string {
+	line := string(l.pending[:end])
+	if n == len(l.pending) {
+		l.pending = l.pending[:0]
+	} else {
+		l.pending = l.pending[n:]
+	}
+	return line
+}
+
+// Close stops the LineReader and returns the data it read from the underlying reader
+// without returning it as lines yet, so reading can carry on from there without it.
+// The underlying reader itself is left open. With a Timeout, a read the background
+// goroutine is still waiting on when Close is called can't be stopped, and the
+// data it returns is lost.
+func (l *LineReader) Close() []byte {
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	close(l.quit)
+	b := l.pending
+	l.pending = nil
+	return b
+}
+
+// read reads the next chunk from the underlying reader into the first half of
+// the buffer.
+func (l *LineReader) read() chunk {
+	return l.readInto(0)
+}
+
+// readInto reads the next chunk into the given half of the buffer, which is
+// allocated the first time.
+func (l *LineReader) readInto(half int) chunk {
+	if l.buf == nil {
+		l.buf = make([]byte, 2*l.size)
+	}
+	b := l.buf[half*l.size : (half+1)*l.size]
+	n, err := l.r.Read(b)
+	return chunk{b: b[:n], err: err}
+}
+
+// fill reads from the underlying reader until it returns an error, or Close is called.
+// It switches halves after each chunk, so it reads on while ReadLine copies the last
+// one out; the next chunk is only taken once that copy is done.
+func (l *LineReader) fill() {
+	for half := 0; ; half = 1 - half {
+		c := l.readInto(half)
+		if len(c.b) > 0 || c.err != nil {
+			select {
+			case l.chunks <- c:
+			case <-l.quit:
+				return
+			}
+		}
+		if c.err != nil {
+			return
+		}
+	}
+}
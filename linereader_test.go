@@ -0,0 +1,126 @@
+package gote
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineReader_Terminators(t *testing.T) {
+	r := NewLineReader(bytes.NewReader([]byte("one\r\ntwo\r\x00three\nfour\rfive")))
+	for _, expected := range []string{"one", "two", "three", "four"} {
+		line, partial, err := r.ReadLine()
+		assert.NoError(t, err)
+		assert.False(t, partial)
+		assert.Equal(t, expected, line)
+	}
+	// the stream ends without a terminator
+	line, partial, err := r.ReadLine()
+	assert.NoError(t, err)
+	assert.True(t, partial)
+	assert.Equal(t, "five", line)
+
+	_, _, err = r.ReadLine()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestLineReader_MaxLength(t *testing.T) {
+	r := NewLineReader(bytes.NewReader([]byte("abcdefg\r\nabc\r\n")))
+	r.MaxLength = 3
+	expected := []struct {
+		line    string
+		partial bool
+	}{
+		{"abc", true},
+		{"def", true},
+		{"g", false},
+		{"abc", false},
+	}
+	for _, e := range expected {
+		line, partial, err := r.ReadLine()
+		assert.NoError(t, err)
+		assert.Equal(t, e.partial, partial)
+		assert.Equal(t, e.line, line)
+	}
+}
+
+func TestLineReader_Timeout(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	r := NewLineReader(pr)
+	r.Timeout = time.Duration(20) * time.Millisecond
+
+	go pw.Write([]byte("login: "))
+	line, partial, err := r.ReadLine()
+	assert.NoError(t, err)
+	assert.True(t, partial)
+	assert.Equal(t, "login: ", line)
+
+	// a CR flushed by the timeout must not produce an empty line when the LF shows up late
+	go func() {
+		pw.Write([]byte("prompt\r"))
+		time.Sleep(time.Duration(50) * time.Millisecond)
+		pw.Write([]byte("\nnext\n"))
+	}()
+	line, partial, err = r.ReadLine()
+	assert.NoError(t, err)
+	assert.False(t, partial)
+	assert.Equal(t, "prompt", line)
+
+	line, partial, err = r.ReadLine()
+	assert.NoError(t, err)
+	assert.False(t, partial)
+	assert.Equal(t, "next", line)
+}
+
+func TestLineReader_Close(t *testing.T) {
+	r := NewLineReader(bytes.NewReader([]byte("one\r\ntwo\r\nthree")))
+	line, _, err := r.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "one", line)
+	// read along with the first line
+	assert.Equal(t, "two\r\nthree", string(r.Close()))
+	_, _, err = r.ReadLine()
+	assert.Equal(t, io.ErrClosedPipe, err)
+
+	// the background goroutine stops instead of waiting to hand over a chunk
+	before := runtime.NumGoroutine()
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	r = NewLineReader(pr)
+	r.Timeout = time.Second
+	go pw.Write([]byte("a\nb"))
+	line, _, err = r.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "a", line)
+	assert.Equal(t, "b", string(r.Close()))
+	// the read it was waiting on is lost
+	pw.Write([]byte("c"))
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 100 {
+			t.Fatal("the background goroutine is still running")
+		}
+		time.Sleep(time.Duration(10) * time.Millisecond)
+	}
+}
+
+func TestLineReader_Allocs(t *testing.T) {
+	l := NewLineReader(repeatReader("line\r\n"))
+	l.ReadLine()
+	// the buffers are reused, only the lines are allocated
+	allocs := testing.AllocsPerRun(100, func() {
+		l.ReadLine()
+	})
+	assert.True(t, allocs <= 1, "%v allocations per line", allocs)
+}
+
+// repeatReader returns itself from every Read.
+type repeatReader string
+
+func (r repeatReader) Read(b []byte) (int, error) {
+	return copy(b, r), nil
+}
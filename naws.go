@@ -0,0 +1,80 @@
+package gote
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrWindowSize is returned by SetWindowSize for a size NAWS can't carry.
+var ErrWindowSize = errors.New("gote: window size out of range")
+
+// WindowSize is a window size in characters, as reported with NAWS.
+type WindowSize struct {
+	Width, Height int
+}
+
+// windowSize reports the window size with NAWS.
+type windowSize struct {
+	BaseOption
+
+	// mu also keeps updates from going out of order
+	mu            sync.Mutex
+	width, height int
+	on            bool
+}
+
+// SetWindowSize sets the window size reported to the server, sending it if NAWS is on.
+func (c *conn) SetWindowSize(width, height int) error {
+	if width < 0 || width > 0xffff || height < 0 || height > 0xffff {
+		return ErrWindowSize
+	}
+	c.cLock.Lock()
+	if c.naws == nil {
+		c.naws = &windowSize{}
+	}
+	w := c.naws
+	c.cLock.Unlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.width, w.height = width, height
+	if !w.on {
+		return nil
+	}
+	return c.SendRawSequence(w.sequence()...)
+}
+
+// Accept agrees to report the window size.
+func (w *windowSize) Accept(cmd byte) bool {
+	return cmd == DO
+}
+
+// Enabled sends the current size.
+func (w *windowSize) Enabled(c Connection, cmd byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.on = true
+	c.SendRawSequence(w.sequence()...)
+}
+
+// Disabled stops updates.
+func (w *windowSize) Disabled(c Connection, cmd byte) {
+	w.mu.Lock()
+	w.on = false
+	w.mu.Unlock()
+}
+
+// sequence returns IAC SB NAWS <width> <height> IAC SE, with the sizes as 16 bit
+// big endian values. The lock must be held.
+func (w *windowSize) sequence() []byte {
+	b := []byte{IAC, SB, NAWS}
+	for _, v := range []int{w.width, w.height} {
+		for _, c := range []byte{byte(v >> 8), byte(v)} {
+			if c == IAC {
+				b = append(b, IAC)
+			}
+			b = append(b, c)
+		}
+	}
+	return append(b, IAC, SE)
+}
@@ -0,0 +1,40 @@
+package gote
+
+import (
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowSize(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	// refused until a size is set
+	err := server.Play(time.Second, fake.Step{Send: []byte{IAC, DO, NAWS}, Expect: []byte{IAC, WONT, NAWS}})
+	assert.NoError(t, err)
+
+	assert.NoError(t, tel.SetWindowSize(80, 24))
+	err = server.Play(time.Second, fake.Step{
+		Send:   []byte{IAC, DO, NAWS},
+		Expect: []byte{IAC, WILL, NAWS, IAC, SB, NAWS, 0, 80, 0, 24, IAC, SE},
+	})
+	assert.NoError(t, err)
+
+	// resizing sends the new size, escaping IAC
+	assert.NoError(t, tel.SetWindowSize(511, 255))
+	assert.NoError(t, server.Expect([]byte{IAC, SB, NAWS, 1, IAC, IAC, 0, IAC, IAC, IAC, SE}, time.Second))
+
+	// but not once the server turned it off
+	err = server.Play(time.Second, fake.Step{Send: []byte{IAC, DONT, NAWS}, Expect: []byte{IAC, WONT, NAWS}})
+	assert.NoError(t, err)
+	assert.NoError(t, tel.SetWindowSize(100, 40))
+	assert.Error(t, server.Expect([]byte{IAC}, time.Duration(200)*time.Millisecond))
+
+	assert.Equal(t, ErrWindowSize, tel.SetWindowSize(70000, 24))
+	assert.Equal(t, ErrWindowSize, tel.SetWindowSize(80, -1))
+}
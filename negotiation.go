@@ -0,0 +1,130 @@
+package gote
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/morganhein/go-telnet/codec"
+)
+
+// maxSettle is how many settle periods DialNegotiated waits at most, for servers
+// that never stop negotiating.
+const maxSettle = 10
+
+// Negotiation is a single WILL, WONT, DO or DONT, sent or received.
+type Negotiation struct {
+	// Sent is set on negotiation sent by the connection, and clear on the server's.
+	Sent bool
+	Cmd  byte
+	Opt  byte
+}
+
+func (n Negotiation) String() string {
+	dir := "received"
+	if n.Sent {
+		dir = "sent"
+	}
+	return dir + " IAC " + codec.CommandName(n.Cmd) + " " + codec.OptionName(n.Opt)
+}
+
+// DialResult describes the initial negotiation of a connection from DialNegotiated.
+type DialResult struct {
+	// Transcript is all the negotiation exchanged until it settled, in order.
+	Transcript []Negotiation
+	// Remote holds every option negotiated for the server's side, and whether it
+	// ended up enabled: the server said WILL and the connection agreed with DO.
+	Remote map[byte]bool
+	// Local is the same for the connection's side: the server asked with DO and
+	// the connection agreed with WILL.
+	Local map[byte]bool
+}
+
+// DialNegotiated connects like Dial, then waits for the initial negotiation to
+// settle, that is until no negotiation was exchanged for settle, and returns it
+// along with the connection. It waits ten times settle at most. This lets callers
+// decide on a device right away, for example refusing one that won't do BINARY.
+func DialNegotiated(network, address string, settle time.Duration) (Connection, *DialResult, error) {
+	c := &conn{transcript: &transcript{last: time.Now()}}
+	if _, err := c.dial(context.Background(), &Dialer{}, network, address); err != nil {
+		return nil, nil, err
+	}
+	res := c.transcript.settle(settle, c.Done())
+	return c, res, nil
+}
+
+// transcript records negotiation until it is settled.
+type transcript struct {
+	mu      sync.Mutex
+	entries []Negotiation
+	last    time.Time
+	stopped bool
+}
+
+func (t *transcript) add(sent bool, cmd, opt byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	t.entries = append(t.entries, Negotiation{Sent: sent, Cmd: cmd, Opt: opt})
+	t.last = time.Now()
+}
+
+// settle waits for settle to pass without negotiation, or the connection to end,
+// then stops recording and returns the result.
+func (t *transcript) settle(settle time.Duration, done <-chan struct{}) *DialResult {
+	deadline := time.Now().Add(maxSettle * settle)
+	poll := settle / 4
+	if poll <= 0 {
+		poll = time.Millisecond
+	}
+	for {
+		t.mu.Lock()
+		quiet := time.Since(t.last)
+		t.mu.Unlock()
+		if quiet >= settle || !time.Now().Before(deadline) {
+			return t.result()
+		}
+		select {
+		case <-done:
+			return t.result()
+		case <-time.After(poll):
+		}
+	}
+}
+
+func (t *transcript) result() *DialResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	return &DialResult{
+		Transcript: append([]Negotiation(nil), t.entries...),
+		Remote:     optionStates(t.entries, WILL, DO),
+		Local:      optionStates(t.entries, DO, WILL),
+	}
+}
+
+// optionStates works out which options ended up enabled, given the server's
+// command offering or requesting them and the connection's agreeing one.
+func optionStates(entries []Negotiation, theirs, ours byte) map[byte]bool {
+	// the refusing counterparts of WILL and DO are one higher
+	offered := make(map[byte]bool)
+	agreed := make(map[byte]bool)
+	for _, n := range entries {
+		switch {
+		case !n.Sent && (n.Cmd == theirs || n.Cmd == theirs+1):
+			offered[n.Opt] = n.Cmd == theirs
+		case n.Sent && (n.Cmd == ours || n.Cmd == ours+1):
+			agreed[n.Opt] = n.Cmd == ours
+		}
+	}
+	states := make(map[byte]bool)
+	for opt := range offered {
+		states[opt] = offered[opt] && agreed[opt]
+	}
+	for opt := range agreed {
+		states[opt] = offered[opt] && agreed[opt]
+	}
+	return states
+}
@@ -0,0 +1,46 @@
+package gote
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialNegotiated(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		s, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer s.Close()
+		s.Write([]byte{IAC, WILL, SGA, IAC, WILL, ECHO, IAC, DO, BIN})
+		// negotiation after it settled isn't part of the result
+		time.Sleep(time.Duration(500) * time.Millisecond)
+		s.Write([]byte{IAC, WILL, BIN})
+		time.Sleep(time.Duration(200) * time.Millisecond)
+	}()
+
+	c, res, err := DialNegotiated("tcp", l.Addr().String(), time.Duration(200)*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assert.Equal(t, []Negotiation{
+		{false, WILL, SGA},
+		{true, DO, SGA},
+		{false, WILL, ECHO},
+		{true, DO, ECHO},
+		{false, DO, BIN},
+		{true, WILL, BIN},
+	}, res.Transcript)
+	assert.Equal(t, map[byte]bool{SGA: true, ECHO: true}, res.Remote)
+	assert.Equal(t, map[byte]bool{BIN: true}, res.Local)
+	assert.Equal(t, "sent IAC WILL BINARY", res.Transcript[5].String())
+}
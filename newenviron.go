@@ -0,0 +1,163 @@
+package gote
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/morganhein/go-telnet/environ"
+)
+
+// environment holds the variables reported with NEW-ENVIRON, or the original
+// ENVIRON (RFC 1408) for servers that only speak that.
+type environment struct {
+	// mu also keeps INFO updates and IS replies from going out of order
+	mu   sync.Mutex
+	vars map[string]string
+	on   map[byte]bool // by option
+	// swapped is set once an ENVIRON request came with VAR and VALUE swapped
+	swapped bool
+}
+
+// environOption answers requests for one of the two options from the environment.
+type environOption struct {
+	BaseOption
+	e   *environment
+	opt byte
+}
+
+// SetEnviron sets the variables reported to the server, sending the changes if
+// NEW-ENVIRON is on.
+func (c *conn) SetEnviron(vars map[string]string) error {
+	c.cLock.Lock()
+	if c.env == nil {
+		c.env = &environment{on: make(map[byte]bool)}
+	}
+	e := c.env
+	c.cLock.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var changed []environ.Var
+	for _, name := range sortedNames(vars) {
+		if old, ok := e.vars[name]; !ok || old != vars[name] {
+			changed = append(changed, environ.New(name, vars[name]))
+		}
+	}
+	for _, name := range sortedNames(e.vars) {
+		if _, ok := vars[name]; !ok {
+			v := environ.New(name, "")
+			v.Unset = true
+			changed = append(changed, v)
+		}
+	}
+	e.vars = make(map[string]string, len(vars))
+	for name, value := range vars {
+		e.vars[name] = value
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	switch {
+	case e.on[environ.Option]:
+		return c.SendRawSequence(Subnegotiation(environ.Option, INFO, environ.Encode(changed...))...)
+	case e.on[environ.LegacyOption]:
+		return c.SendRawSequence(Subnegotiation(environ.LegacyOption, INFO, environ.EncodeLegacy(e.swapped, changed...))...)
+	}
+	return nil
+}
+
+// Accept agrees to report the environment. ENVIRON is refused while NEW-ENVIRON
+// is on, so a server offering both gets the newer one.
+func (o environOption) Accept(cmd byte) bool {
+	if cmd != DO {
+		return false
+	}
+	o.e.mu.Lock()
+	defer o.e.mu.Unlock()
+	return o.opt == environ.Option || !o.e.on[environ.Option]
+}
+
+// Enabled allows INFO updates.
+func (o environOption) Enabled(c Connection, cmd byte) {
+	o.e.mu.Lock()
+	o.e.on[o.opt] = true
+	o.e.mu.Unlock()
+}
+
+// Disabled stops INFO updates.
+func (o environOption) Disabled(c Connection, cmd byte) {
+	o.e.mu.Lock()
+	o.e.on[o.opt] = false
+	o.e.mu.Unlock()
+}
+
+// Subnegotiation answers IAC SB NEW-ENVIRON SEND ... IAC SE with IS and the
+// variables asked for, and ENVIRON the same way, in the server's order of the
+// VAR and VALUE codes. Anything else from the server is ignored.
+func (o environOption) Subnegotiation(c Connection, payload []byte) error {
+	q, list, err := SplitQualifier(payload)
+	if err != nil || q != SEND {
+		return nil
+	}
+	e := o.e
+	if o.opt == environ.LegacyOption {
+		asked, err := environ.DecodeLegacy(list)
+		if err != nil {
+			return nil
+		}
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		// a request for all variables has nothing to go by
+		if len(list) > 0 {
+			e.swapped = environ.Swapped(list)
+		}
+		return c.SendRawSequence(Subnegotiation(o.opt, IS, environ.EncodeLegacy(e.swapped, e.answer(asked, true)...))...)
+	}
+	asked, err := environ.Decode(list)
+	if err != nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return c.SendRawSequence(Subnegotiation(o.opt, IS, environ.Encode(e.answer(asked, false)...))...)
+}
+
+// answer returns the variables asked for by a SEND. An empty list asks for all of
+// them, and a VAR or USERVAR without a name for all of that type, or all of them
+// for ENVIRON, which has no USERVAR. Variables that aren't set are sent without
+// a value. The lock must be held.
+func (e *environment) answer(asked []environ.Var, legacy bool) []environ.Var {
+	var all []environ.Var
+	for _, name := range sortedNames(e.vars) {
+		all = append(all, environ.New(name, e.vars[name]))
+	}
+	if len(asked) == 0 {
+		return all
+	}
+	var vars []environ.Var
+	for _, a := range asked {
+		if a.Name == "" {
+			for _, v := range all {
+				if legacy || v.User == a.User {
+					vars = append(vars, v)
+				}
+			}
+			continue
+		}
+		v := environ.Var{Name: a.Name, User: a.User, Unset: true}
+		if value, ok := e.vars[a.Name]; ok {
+			v.Value, v.Unset = value, false
+		}
+		vars = append(vars, v)
+	}
+	return vars
+}
+
+func sortedNames(vars map[string]string) []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
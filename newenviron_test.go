@@ -0,0 +1,114 @@
+package gote
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/environ"
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnviron(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	// refused until the environment is set
+	err := server.Play(time.Second, fake.Step{Send: []byte{IAC, DO, environ.Option}, Expect: []byte{IAC, WONT, environ.Option}})
+	assert.NoError(t, err)
+
+	// nothing to send yet
+	assert.NoError(t, tel.SetEnviron(map[string]string{"USER": "gandalf", "COLS\x01": "80"}))
+	send := func(vars ...environ.Var) []byte {
+		return Subnegotiation(environ.Option, SEND, environ.Encode(vars...))
+	}
+	is := func(vars ...environ.Var) []byte {
+		return Subnegotiation(environ.Option, IS, environ.Encode(vars...))
+	}
+	user, cols := environ.New("USER", "gandalf"), environ.New("COLS\x01", "80")
+	display := environ.Names("DISPLAY")[0]
+	err = server.Play(time.Second,
+		fake.Step{Send: []byte{IAC, DO, environ.Option}, Expect: []byte{IAC, WILL, environ.Option}},
+		// everything, with the type codes in names escaped
+		fake.Step{Send: send(), Expect: is(cols, user)},
+		fake.Step{Send: send(environ.Names("USER", "DISPLAY")...), Expect: is(user, display)},
+		// every well known variable, then every user variable
+		fake.Step{Send: send(environ.Var{Unset: true}), Expect: is(user)},
+		fake.Step{Send: send(environ.Var{User: true, Unset: true}), Expect: is(cols)},
+	)
+	assert.NoError(t, err)
+
+	// changes go out as INFO, including variables that are gone
+	assert.NoError(t, tel.SetEnviron(map[string]string{"USER": "frodo"}))
+	unset := cols
+	unset.Value, unset.Unset = "", true
+	info := Subnegotiation(environ.Option, INFO, environ.Encode(environ.New("USER", "frodo"), unset))
+	assert.NoError(t, server.Expect(info, time.Second))
+}
+
+func TestEnviron_Limit(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.SetEnviron(map[string]string{"USER": "gandalf"})
+	tel.start(client)
+	defer tel.Close()
+
+	err := server.Play(time.Second, fake.Step{Send: []byte{IAC, DO, environ.Option}, Expect: []byte{IAC, WILL, environ.Option}})
+	assert.NoError(t, err)
+	var flood []byte
+	for i := 0; i < 100; i++ {
+		flood = append(flood, Subnegotiation(environ.Option, SEND, nil)...)
+	}
+	server.Write(flood)
+	var out []byte
+	b := make([]byte, 1024)
+	for {
+		// until nothing more comes
+		server.SetReadDeadline(time.Now().Add(time.Duration(100) * time.Millisecond))
+		n, err := server.Read(b)
+		if err != nil {
+			break
+		}
+		out = append(out, b[:n]...)
+	}
+	// the agreement and the answers share the cap
+	is := Subnegotiation(environ.Option, IS, environ.Encode(environ.New("USER", "gandalf")))
+	assert.Equal(t, defaultMaxReplies-1, bytes.Count(out, is))
+}
+
+func TestEnviron_Legacy(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.SetEnviron(map[string]string{"USER": "gandalf", "TERM": "vt100"})
+	tel.start(client)
+	defer tel.Close()
+
+	legacy := func(q Qualifier, list ...byte) []byte {
+		return Subnegotiation(environ.LegacyOption, q, list)
+	}
+	user := environ.New("USER", "gandalf")
+	err := server.Play(time.Second,
+		fake.Step{Send: []byte{IAC, DO, environ.LegacyOption}, Expect: []byte{IAC, WILL, environ.LegacyOption}},
+		// user variables go out as VAR
+		fake.Step{Send: legacy(SEND), Expect: legacy(IS, environ.EncodeLegacy(false, environ.New("TERM", "vt100"), user)...)},
+		// answered in the server's order of VAR and VALUE
+		fake.Step{Send: legacy(SEND, environ.VALUE, 'U', 'S', 'E', 'R'), Expect: legacy(IS, environ.EncodeLegacy(true, user)...)},
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, tel.SetEnviron(map[string]string{"USER": "frodo"}))
+	unset := environ.New("TERM", "")
+	unset.Unset = true
+	info := legacy(INFO, environ.EncodeLegacy(true, environ.New("USER", "frodo"), unset)...)
+	assert.NoError(t, server.Expect(info, time.Second))
+
+	// with NEW-ENVIRON on, ENVIRON is refused
+	err = server.Play(time.Second,
+		fake.Step{Send: []byte{IAC, DONT, environ.LegacyOption}, Expect: []byte{IAC, WONT, environ.LegacyOption}},
+		fake.Step{Send: []byte{IAC, DO, environ.Option}, Expect: []byte{IAC, WILL, environ.Option}},
+		fake.Step{Send: []byte{IAC, DO, environ.LegacyOption}, Expect: []byte{IAC, WONT, environ.LegacyOption}},
+	)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,198 @@
+package gote
+
+import (
+	"sync"
+
+	"github.com/morganhein/go-telnet/environ"
+)
+
+// OptionHandler negotiates one telnet option on behalf of a connection. Its methods
+// are called from the connection's processing goroutine, one at a time, once the
+// input they came with has been parsed, so they may use the connection.
+type OptionHandler interface {
+	// Accept is called when the peer asks for the option while it is off. cmd is
+	// WILL when the peer offers to enable it on its side, or DO when the peer asks
+	// for it to be enabled on ours. Returning true agrees, with DO or WILL, and
+	// false refuses, with DONT or WONT.
+	Accept(cmd byte) bool
+	// Enabled is called once the option is on, after the agreement was sent, with
+	// the WILL or DO that turned it on. It may go on to send subnegotiation.
+	Enabled(c Connection, cmd byte)
+	// Disabled is called once the option is off again, with the WONT or DONT
+	// that turned it off, or that refused a server's offer or request.
+	Disabled(c Connection, cmd byte)
+	// Subnegotiation is called with the payload of each IAC SB <opt> ... IAC SE
+	// received for the option, without the option byte and with escaped IAC bytes
+	// decoded. payload is only valid until it returns. An error fails the connection.
+	Subnegotiation(c Connection, payload []byte) error
+}
+
+// BaseOption is an OptionHandler that refuses its option and does nothing else.
+// Embed it to only implement the methods you need.
+type BaseOption struct{}
+
+// Accept refuses the option.
+func (BaseOption) Accept(cmd byte) bool { return false }
+
+// Enabled does nothing.
+func (BaseOption) Enabled(c Connection, cmd byte) {}
+
+// Disabled does nothing.
+func (BaseOption) Disabled(c Connection, cmd byte) {}
+
+// Subnegotiation ignores the payload.
+func (BaseOption) Subnegotiation(c Connection, payload []byte) error { return nil }
+
+// optSides says which sides of an option are on.
+type optSides uint8
+
+const (
+	ourSide optSides = 1 << iota
+	theirSide
+)
+
+// RegisterOption sets the handler for an option.
+func (c *conn) RegisterOption(opt byte, h OptionHandler) {
+	c.cLock.Lock()
+	defer c.cLock.Unlock()
+	if h == nil {
+		delete(c.options, opt)
+		return
+	}
+	if c.options == nil {
+		c.options = make(map[byte]OptionHandler)
+	}
+	c.options[opt] = h
+}
+
+// plugins holds the option handlers registered with RegisterPlugin.
+var (
+	pluginsMu sync.RWMutex
+	plugins   = make(map[byte]func() OptionHandler)
+)
+
+// RegisterPlugin makes every connection handle opt with a handler made by newHandler,
+// unless RegisterOption sets another one. Each connection makes its own, the first
+// time the option comes up. It is meant to be called from the init function of a
+// package implementing an option, such as those under options, so that importing
+// the package is enough to enable it. A later registration replaces an earlier
+// one, and a nil newHandler removes it.
+func RegisterPlugin(opt byte, newHandler func() OptionHandler) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if newHandler == nil {
+		delete(plugins, opt)
+		return
+	}
+	plugins[opt] = newHandler
+}
+
+// plugin makes a handler for opt from the registered plugins.
+func plugin(opt byte) OptionHandler {
+	pluginsMu.RLock()
+	newHandler := plugins[opt]
+	pluginsMu.RUnlock()
+	if newHandler == nil {
+		return nil
+	}
+	return newHandler()
+}
+
+// optionHandler returns the handler for opt, falling back on the built in ones,
+// then on plugins.
+func (c *conn) optionHandler(opt byte) OptionHandler {
+	c.cLock.Lock()
+	defer c.cLock.Unlock()
+	if h, ok := c.options[opt]; ok {
+		return h
+	}
+	if opt == TTYPE && c.ttype != nil {
+		return c.ttype
+	}
+	if opt == NAWS && c.naws != nil {
+		return c.naws
+	}
+	if (opt == environ.Option || opt == environ.LegacyOption) && c.env != nil {
+		return environOption{e: c.env, opt: opt}
+	}
+	// servers decide on ECHO and BINARY with Listener.Will and Do
+	if opt == ECHO && c.server == nil {
+		return remoteEcho{}
+	}
+	if opt == BIN && c.server == nil {
+		return binaryOption{}
+	}
+	if h, ok := c.plugins[opt]; ok {
+		return h
+	}
+	h := plugin(opt)
+	if h == nil {
+		return nil
+	}
+	if c.plugins == nil {
+		c.plugins = make(map[byte]OptionHandler)
+	}
+	c.plugins[opt] = h
+	return h
+}
+
+// negotiateOption answers a negotiation command for an option with a handler.
+// Requests to enter the state the option is already in are not answered, and
+// requests whose answer is dropped by the reply limit leave the option as it was.
+func (c *conn) negotiateOption(h OptionHandler, cmd, opt byte) {
+	side, yes, no := theirSide, DO, DONT
+	if cmd == DO || cmd == DONT {
+		side, yes, no = ourSide, WILL, WONT
+	}
+	sides := c.sides(opt)
+	on := sides&side != 0
+	switch {
+	case (cmd == WILL || cmd == DO) && !on:
+		if !h.Accept(cmd) {
+			c.reply(no, opt)
+			return
+		}
+		if !c.reply(yes, opt) {
+			return
+		}
+		sides |= side
+		c.setSides(opt, sides)
+		c.changed(opt, side == theirSide, true)
+		c.later(func() { h.Enabled(handlerConn{c}, cmd) })
+	case (cmd == WONT || cmd == DONT) && on:
+		if !c.reply(no, opt) {
+			return
+		}
+		sides &^= side
+		c.setSides(opt, sides)
+		c.changed(opt, side == theirSide, false)
+		c.later(func() { h.Disabled(handlerConn{c}, cmd) })
+	}
+	switch opt {
+	case BIN:
+		c.setBinary(sides&theirSide != 0)
+	case ECHO:
+		c.setRemoteEcho(sides&theirSide != 0)
+	}
+}
+
+// sides returns which sides of opt are on.
+func (c *conn) sides(opt byte) optSides {
+	c.cLock.Lock()
+	defer c.cLock.Unlock()
+	return c.enabled[opt]
+}
+
+// setSides records which sides of opt are on.
+func (c *conn) setSides(opt byte, sides optSides) {
+	c.cLock.Lock()
+	defer c.cLock.Unlock()
+	if sides == 0 {
+		delete(c.enabled, opt)
+		return
+	}
+	if c.enabled == nil {
+		c.enabled = make(map[byte]optSides)
+	}
+	c.enabled[opt] = sides
+}
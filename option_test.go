@@ -0,0 +1,111 @@
+package gote
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingOption accepts the commands in accept and records its calls.
+type recordingOption struct {
+	BaseOption
+	accept []byte
+	calls  []string
+}
+
+func (o *recordingOption) Accept(cmd byte) bool {
+	return bytes.IndexByte(o.accept, cmd) != -1
+}
+
+func (o *recordingOption) Enabled(c Connection, cmd byte) {
+	o.calls = append(o.calls, "enabled "+string(rune(cmd)))
+	// anything sent here goes out after the agreement
+	c.SendRawSequence(Subnegotiation(24, IS, []byte("xterm"))...)
+}
+
+func (o *recordingOption) Disabled(c Connection, cmd byte) {
+	o.calls = append(o.calls, "disabled "+string(rune(cmd)))
+}
+
+func TestRegisterOption(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{
+		Conn: client,
+		i:    bytes.NewBuffer(nil),
+		u:    bytes.NewBuffer(nil),
+	}
+	o := &recordingOption{accept: []byte{DO}}
+	tel.RegisterOption(24, o)
+
+	tel.i.Write([]byte{IAC, DO, 24, IAC, DO, 24, IAC, WILL, 24, IAC, DONT, 24, IAC, DONT, 24})
+	tel.parse()
+	tel.callbacks()
+	tel.flush()
+	expected := []byte{IAC, WILL, 24}
+	expected = append(expected, Subnegotiation(24, IS, []byte("xterm"))...)
+	expected = append(expected, IAC, DONT, 24, IAC, WONT, 24)
+	assert.NoError(t, server.Expect(expected, time.Second))
+	assert.Equal(t, []string{"enabled " + string(rune(DO)), "disabled " + string(rune(DONT))}, o.calls)
+
+	// back to the defaults
+	tel.RegisterOption(24, nil)
+	tel.i.Write([]byte{IAC, DO, 24})
+	tel.parse()
+	tel.callbacks()
+	tel.flush()
+	assert.NoError(t, server.Expect([]byte{IAC, WONT, 24}, time.Second))
+}
+
+func TestRegisterOption_Server(t *testing.T) {
+	l := &Listener{Will: []byte{ECHO}}
+	server, client := fake.Pipe()
+	c, err := l.serve(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	o := &recordingOption{accept: []byte{WILL}}
+	c.RegisterOption(ECHO, o)
+	c.RegisterOption(31, o)
+
+	err = client.Play(time.Second,
+		fake.Step{Expect: []byte{IAC, WILL, ECHO}},
+		fake.Step{Send: []byte{IAC, DONT, ECHO, IAC, WILL, 31}, Expect: []byte{IAC, DO, 31}},
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, client.Expect(Subnegotiation(24, IS, []byte("xterm")), time.Second))
+}
+
+func TestRegisterPlugin(t *testing.T) {
+	made := 0
+	RegisterPlugin(200, func() OptionHandler {
+		made++
+		return policyOption{accept: true}
+	})
+	defer RegisterPlugin(200, nil)
+
+	client, server := fake.Pipe()
+	tel := &conn{
+		Conn: client,
+		i:    bytes.NewBuffer(nil),
+		u:    bytes.NewBuffer(nil),
+	}
+	tel.i.Write([]byte{IAC, WILL, 200, IAC, WONT, 200, IAC, WILL, 200})
+	tel.parse()
+	tel.callbacks()
+	tel.flush()
+	assert.NoError(t, server.Expect([]byte{IAC, DO, 200, IAC, DONT, 200, IAC, DO, 200}, time.Second))
+	// one handler for the life of the connection
+	assert.Equal(t, 1, made)
+
+	// a registered option comes first
+	tel.RegisterOption(200, BaseOption{})
+	tel.i.Write([]byte{IAC, WONT, 200, IAC, WILL, 200})
+	tel.parse()
+	tel.callbacks()
+	tel.flush()
+	assert.NoError(t, server.Expect([]byte{IAC, DONT, 200, IAC, DONT, 200}, time.Second))
+}
@@ -0,0 +1,97 @@
+// Package charset negotiates the character set of connections with CHARSET
+// (option 42, RFC 2066). Importing it enables the option: connections agree to
+// CHARSET on either side, and answer each REQUEST with the first of the offered
+// character sets found in Preferred, or reject it if there is none.
+// Translation tables aren't supported, and are rejected.
+package charset
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/morganhein/go-telnet"
+)
+
+// Option is the telnet option code of CHARSET.
+const Option = 42
+
+// Subnegotiation codes.
+const (
+	Request        = 1
+	Accepted       = 2
+	Rejected       = 3
+	TTableIs       = 4
+	TTableRejected = 5
+	TTableAck      = 6
+	TTableNak      = 7
+)
+
+// Preferred lists the character sets that are accepted, most preferred first.
+// Names are compared without regard to case. Change it before connecting.
+var Preferred = []string{"UTF-8", "US-ASCII"}
+
+func init() {
+	gote.RegisterPlugin(Option, func() gote.OptionHandler { return handler{} })
+}
+
+type handler struct {
+	gote.BaseOption
+}
+
+// Accept agrees to CHARSET on either side.
+func (handler) Accept(cmd byte) bool {
+	return true
+}
+
+// Subnegotiation answers requests and translation tables.
+func (handler) Subnegotiation(c gote.Connection, payload []byte) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	switch payload[0] {
+	case Request:
+		name := choose(parse(payload[1:]))
+		if name == "" {
+			return c.SendRawSequence(gote.Subnegotiation(Option, Rejected, nil)...)
+		}
+		return c.SendRawSequence(gote.Subnegotiation(Option, Accepted, []byte(name))...)
+	case TTableIs:
+		return c.SendRawSequence(gote.Subnegotiation(Option, TTableRejected, nil)...)
+	}
+	return nil
+}
+
+// parse returns the character sets listed by a REQUEST, after the code: an optional
+// "[TTABLE ]" and version byte, then each name preceded by a separator, which is
+// whatever the first byte is.
+func parse(b []byte) []string {
+	if ttable := []byte("[TTABLE ]"); bytes.HasPrefix(b, ttable) {
+		b = b[len(ttable):]
+		if len(b) > 0 {
+			b = b[1:]
+		}
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	var names []string
+	for _, name := range bytes.Split(b[1:], b[:1]) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names
+}
+
+// choose returns the offered name of the most preferred character set on offer,
+// or "" if none are.
+func choose(offered []string) string {
+	for _, p := range Preferred {
+		for _, name := range offered {
+			if strings.EqualFold(p, name) {
+				return name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package charset
+
+import (
+	"testing"
+
+	"github.com/morganhein/go-telnet"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder is a connection that only records the sequences sent on it.
+type recorder struct {
+	gote.Connection
+	sent [][]byte
+}
+
+func (r *recorder) SendRawSequence(b ...byte) error {
+	r.sent = append(r.sent, b)
+	return nil
+}
+
+func TestParse(t *testing.T) {
+	assert.Equal(t, []string{"ISO-8859-1", "utf-8"}, parse([]byte(";ISO-8859-1;utf-8")))
+	assert.Equal(t, []string{"UTF-8"}, parse([]byte("[TTABLE ]\x01 UTF-8")))
+	assert.Nil(t, parse(nil))
+}
+
+func TestHandler(t *testing.T) {
+	r := &recorder{}
+	h := handler{}
+	assert.True(t, h.Accept(gote.WILL))
+	assert.True(t, h.Accept(gote.DO))
+
+	assert.NoError(t, h.Subnegotiation(r, []byte("\x01;ISO-8859-1;utf-8;US-ASCII")))
+	assert.NoError(t, h.Subnegotiation(r, []byte("\x01 KOI8-R")))
+	assert.NoError(t, h.Subnegotiation(r, []byte{TTableIs, 1}))
+	assert.Equal(t, [][]byte{
+		gote.Subnegotiation(Option, Accepted, []byte("utf-8")),
+		gote.Subnegotiation(Option, Rejected, nil),
+		gote.Subnegotiation(Option, TTableRejected, nil),
+	}, r.sent)
+}
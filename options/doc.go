@@ -0,0 +1,11 @@
+// Package options is the home of telnet options implemented as plugins. Each
+// subpackage registers its option with gote.RegisterPlugin from init, so a binary
+// only carries the options it imports, and importing one is all it takes to enable
+// it on every connection:
+//
+//	import _ "github.com/morganhein/go-telnet/options/charset"
+//
+// Options outside this tree can be published the same way, against gote.OptionHandler
+// and gote.RegisterPlugin. TTYPE, NAWS and NEW-ENVIRON are built into gote itself,
+// since they are configured through Connection.
+package options
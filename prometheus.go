@@ -0,0 +1,114 @@
+package gote
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/morganhein/go-telnet/codec"
+)
+
+// WritePrometheus writes the stats of a set of sessions, keyed by a name for each
+// session, in the Prometheus text exposition format. It is meant to be called from
+// an HTTP handler serving /metrics, with snapshots taken from Connection.Stats.
+func WritePrometheus(w io.Writer, sessions map[string]Stats) error {
+	names := make([]string, 0, len(sessions))
+	for name := range sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# HELP gote_sessions Number of telnet sessions.")
+	fmt.Fprintln(bw, "# TYPE gote_sessions gauge")
+	fmt.Fprintf(bw, "gote_sessions %d\n", len(sessions))
+
+	fmt.Fprintln(bw, "# HELP gote_ignored_commands_total Commands received from the server and ignored.")
+	fmt.Fprintln(bw, "# TYPE gote_ignored_commands_total counter")
+	for _, name := range names {
+		ignored := sessions[name].Ignored
+		cmds := make([]int, 0, len(ignored))
+		for cmd := range ignored {
+			cmds = append(cmds, int(cmd))
+		}
+		sort.Ints(cmds)
+		for _, cmd := range cmds {
+			fmt.Fprintf(bw, "gote_ignored_commands_total{session=%s,command=%s} %d\n",
+				label(name), label(codec.CommandName(byte(cmd))), ignored[byte(cmd)])
+		}
+	}
+
+	for _, m := range []struct {
+		name, help string
+		value      func(OptionStats) uint64
+	}{
+		{"gote_option_negotiations_total", "Negotiation commands received from the server, by option.",
+			func(o OptionStats) uint64 { return o.Negotiations }},
+		{"gote_option_subnegotiations_total", "Subnegotiations received from the server, by option.",
+			func(o OptionStats) uint64 { return o.Subnegotiations }},
+		{"gote_option_replies_dropped_total", "Replies left out by the per-option reply limit.",
+			func(o OptionStats) uint64 { return o.Dropped }},
+	} {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(bw, "# TYPE %s counter\n", m.name)
+		for _, name := range names {
+			options := sessions[name].Options
+			opts := make([]int, 0, len(options))
+			for opt := range options {
+				opts = append(opts, int(opt))
+			}
+			sort.Ints(opts)
+			for _, opt := range opts {
+				fmt.Fprintf(bw, "%s{session=%s,option=%s} %d\n",
+					m.name, label(name), label(codec.OptionName(byte(opt))), m.value(options[byte(opt)]))
+			}
+		}
+	}
+
+	fmt.Fprintln(bw, "# HELP gote_arrival_gap_seconds Pauses between arrivals of data from the server.")
+	fmt.Fprintln(bw, "# TYPE gote_arrival_gap_seconds histogram")
+	for _, name := range names {
+		s := sessions[name]
+		var n uint64
+		for _, b := range s.Gaps {
+			n += b.Count
+			le := "+Inf"
+			if b.Max > 0 {
+				le = strconv.FormatFloat(b.Max.Seconds(), 'g', -1, 64)
+			}
+			fmt.Fprintf(bw, "gote_arrival_gap_seconds_bucket{session=%s,le=%q} %d\n", label(name), le, n)
+		}
+		if len(s.Gaps) == 0 {
+			fmt.Fprintf(bw, "gote_arrival_gap_seconds_bucket{session=%s,le=\"+Inf\"} 0\n", label(name))
+		}
+		fmt.Fprintf(bw, "gote_arrival_gap_seconds_sum{session=%s} %s\n", label(name),
+			strconv.FormatFloat(s.GapSum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(bw, "gote_arrival_gap_seconds_count{session=%s} %d\n", label(name), n)
+	}
+
+	fmt.Fprintln(bw, "# HELP gote_wire_bytes_total Bytes read from and written to the network.")
+	fmt.Fprintln(bw, "# TYPE gote_wire_bytes_total counter")
+	for _, name := range names {
+		s := sessions[name]
+		fmt.Fprintf(bw, "gote_wire_bytes_total{session=%s,direction=\"in\"} %d\n", label(name), s.WireIn)
+		fmt.Fprintf(bw, "gote_wire_bytes_total{session=%s,direction=\"out\"} %d\n", label(name), s.WireOut)
+	}
+	fmt.Fprintln(bw, "# HELP gote_data_bytes_total Bytes of application data read and written.")
+	fmt.Fprintln(bw, "# TYPE gote_data_bytes_total counter")
+	for _, name := range names {
+		s := sessions[name]
+		fmt.Fprintf(bw, "gote_data_bytes_total{session=%s,direction=\"in\"} %d\n", label(name), s.DataIn)
+		fmt.Fprintf(bw, "gote_data_bytes_total{session=%s,direction=\"out\"} %d\n", label(name), s.DataOut)
+	}
+	return bw.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// label quotes a label value.
+func label(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
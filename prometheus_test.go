@@ -0,0 +1,47 @@
+package gote
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	a := &conn{}
+	a.ignore(NOP)
+	a.ignore(NOP)
+	a.ignore(100)
+	now := time.Now()
+	a.arrived(now)
+	a.arrived(now.Add(3 * time.Millisecond))
+	a.countIn(12, 9)
+	a.countOption(NAWS, OptionStats{Negotiations: 2, Subnegotiations: 1})
+	a.countOption(NAWS, OptionStats{Dropped: 1})
+
+	var out bytes.Buffer
+	err := WritePrometheus(&out, map[string]Stats{
+		"core-1":    a.Stats(),
+		`odd "one"`: {},
+	})
+	assert.NoError(t, err)
+	s := out.String()
+	assert.Contains(t, s, "# TYPE gote_sessions gauge\ngote_sessions 2\n")
+	assert.Contains(t, s, `gote_ignored_commands_total{session="core-1",command="NOP"} 2`+"\n")
+	assert.Contains(t, s, `gote_ignored_commands_total{session="core-1",command="100"} 1`+"\n")
+	assert.Contains(t, s, `gote_arrival_gap_seconds_bucket{session="core-1",le="0.002"} 0`+"\n")
+	assert.Contains(t, s, `gote_arrival_gap_seconds_bucket{session="core-1",le="0.005"} 1`+"\n")
+	assert.Contains(t, s, `gote_arrival_gap_seconds_bucket{session="core-1",le="+Inf"} 1`+"\n")
+	assert.Contains(t, s, `gote_arrival_gap_seconds_sum{session="core-1"} 0.003`+"\n")
+	assert.Contains(t, s, `gote_arrival_gap_seconds_count{session="odd \"one\""} 0`+"\n")
+	assert.Contains(t, s, `gote_option_negotiations_total{session="core-1",option="NAWS"} 2`+"\n")
+	assert.Contains(t, s, `gote_option_subnegotiations_total{session="core-1",option="NAWS"} 1`+"\n")
+	assert.Contains(t, s, `gote_option_replies_dropped_total{session="core-1",option="NAWS"} 1`+"\n")
+	assert.Contains(t, s, `gote_wire_bytes_total{session="core-1",direction="in"} 12`+"\n")
+	assert.Contains(t, s, `gote_data_bytes_total{session="core-1",direction="in"} 9`+"\n")
+	assert.Contains(t, s, `gote_data_bytes_total{session="odd \"one\"",direction="out"} 0`+"\n")
+	// sessions are sorted by name
+	assert.True(t, strings.Index(s, "core-1") < strings.Index(s, "odd"))
+}
@@ -0,0 +1,56 @@
+package gote
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Qualifier is the first byte of the subnegotiation payload of options such as
+// TTYPE, TSPEED, XDISPLOC and NEW-ENVIRON, saying whether the payload asks
+// for a value or carries one.
+type Qualifier byte
+
+// Qualifiers
+const (
+	IS   = Qualifier(0) // the payload carries the value
+	SEND = Qualifier(1) // the payload asks for the value
+	INFO = Qualifier(2) // the payload carries an unsolicited update (NEW-ENVIRON)
+)
+
+func (q Qualifier) String() string {
+	switch q {
+	case IS:
+		return "IS"
+	case SEND:
+		return "SEND"
+	case INFO:
+		return "INFO"
+	}
+	return fmt.Sprintf("Qualifier(%d)", byte(q))
+}
+
+// ErrNoQualifier is returned by SplitQualifier for an empty payload.
+var ErrNoQualifier = errors.New("gote: subnegotiation has no qualifier")
+
+// SplitQualifier splits a subnegotiation payload, without the option byte,
+// into its qualifier and the rest of the payload.
+func SplitQualifier(payload []byte) (Qualifier, []byte, error) {
+	if len(payload) == 0 {
+		return 0, nil, ErrNoQualifier
+	}
+	return Qualifier(payload[0]), payload[1:], nil
+}
+
+// Subnegotiation returns the full IAC SB <opt> <q> data IAC SE sequence,
+// with any IAC in data escaped.
+func Subnegotiation(opt byte, q Qualifier, data []byte) []byte {
+	b := make([]byte, 0, len(data)+6)
+	b = append(b, IAC, SB, opt, byte(q))
+	for _, c := range data {
+		if c == IAC {
+			b = append(b, IAC)
+		}
+		b = append(b, c)
+	}
+	return append(b, IAC, SE)
+}
@@ -0,0 +1,33 @@
+package gote
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitQualifier(t *testing.T) {
+	q, rest, err := SplitQualifier([]byte{0, 'x', 't'})
+	assert.NoError(t, err)
+	assert.Equal(t, IS, q)
+	assert.Equal(t, []byte("xt"), rest)
+
+	q, rest, err = SplitQualifier([]byte{1})
+	assert.NoError(t, err)
+	assert.Equal(t, SEND, q)
+	assert.Empty(t, rest)
+
+	_, _, err = SplitQualifier(nil)
+	assert.Equal(t, ErrNoQualifier, err)
+}
+
+func TestSubnegotiation(t *testing.T) {
+	b := Subnegotiation(24, IS, []byte{'a', IAC, 'b'})
+	assert.Equal(t, []byte{IAC, SB, 24, 0, 'a', IAC, IAC, 'b', IAC, SE}, b)
+	assert.NoError(t, validSequence(b))
+}
+
+func TestQualifier_String(t *testing.T) {
+	assert.Equal(t, "SEND", SEND.String())
+	assert.Equal(t, "Qualifier(9)", Qualifier(9).String())
+}
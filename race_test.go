@@ -0,0 +1,93 @@
+package gote
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+// The thread-safety contract, meant to be run with -race: a connection supports one
+// reader and one writer at a time, concurrently with each other, with negotiation
+// happening in the background, and with Close, SendRawSequence and handler registration
+// from any goroutine. Every connection must end with all of its goroutines stopped.
+
+func TestRace_Pipeline(t *testing.T) {
+	n := 1000
+	if testing.Short() {
+		n = 100
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			hammer(t, time.Duration(i%20)*time.Millisecond)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// hammer runs a single connection through concurrent use, closing it after delay.
+func hammer(t *testing.T, delay time.Duration) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	// the server side: data mixed with negotiation, and draining replies
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 20; j++ {
+			if _, err := server.Write([]byte{'a', IAC, DO, ECHO, 'b', IAC, IAC, IAC, WILL, SGA, IAC, NOP}); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		b := make([]byte, 64)
+		for {
+			if _, err := server.Read(b); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		b := make([]byte, 7)
+		for {
+			if _, err := tel.Read(b); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 20; j++ {
+			if _, err := tel.Write([]byte("hello")); err != nil {
+				return
+			}
+			tel.SendRawSequence(IAC, NOP)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		tel.RegisterCommand(NOP, func(byte) error { return nil })
+		tel.SetUnknownCommand(FailUnknown)
+		time.Sleep(delay)
+		tel.Close()
+		server.Close()
+	}()
+	wg.Wait()
+
+	select {
+	case <-tel.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("connection goroutines didn't stop")
+	}
+	assert.Equal(t, ErrClosed, tel.Err())
+}
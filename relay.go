@@ -0,0 +1,118 @@
+package gote
+
+import (
+	"io"
+	"sync"
+)
+
+// relay passes the negotiation received to another telnet implementation, and
+// mirrors the state of the options from what goes through in both directions.
+type relay struct {
+	mu sync.Mutex
+	w  io.Writer
+	// will and do hold the sides of each option offered with WILL, and agreed to with DO
+	will, do map[byte]optSides
+}
+
+// SetRelay passes negotiation to w instead of answering it.
+func (c *conn) SetRelay(w io.Writer) {
+	c.cLock.Lock()
+	if c.relay == nil {
+		c.relay = &relay{will: make(map[byte]optSides), do: make(map[byte]optSides)}
+	}
+	r := c.relay
+	c.cLock.Unlock()
+	r.mu.Lock()
+	r.w = w
+	r.mu.Unlock()
+}
+
+// relayed writes a negotiation or subnegotiation sequence received to the relay,
+// if there is one, and reports whether it did.
+func (c *conn) relayed(seq []byte) bool {
+	c.cLock.Lock()
+	r := c.relay
+	c.cLock.Unlock()
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return false
+	}
+	if seq[1] != SB {
+		r.mirror(c, false, seq[1], seq[2])
+	}
+	if _, err := r.w.Write(seq); err != nil {
+		c.fail(err)
+	}
+	return true
+}
+
+// sent mirrors the negotiation in a sequence sent with SendRawSequence, which must
+// be well formed.
+func (c *conn) sent(b []byte) {
+	c.cLock.Lock()
+	r := c.relay
+	c.cLock.Unlock()
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return
+	}
+	for i := 0; i+1 < len(b); {
+		switch cmd := b[i+1]; {
+		case cmd >= WILL && cmd <= DONT:
+			r.mirror(c, true, cmd, b[i+2])
+			i += 3
+		case cmd == SB:
+			i += 3
+			for !(b[i] == IAC && b[i+1] == SE) {
+				if b[i] == IAC {
+					i++
+				}
+				i++
+			}
+			i += 2
+		default:
+			i += 2
+		}
+	}
+}
+
+// mirror updates an option's state with a negotiation command, sent by the connection
+// or received by it. A side of an option is on once one end said WILL and the other
+// DO, in either order, until either end says WONT or DONT. The lock must be held.
+func (r *relay) mirror(c *conn, sent bool, cmd, opt byte) {
+	side := theirSide
+	if sent == (cmd == WILL || cmd == WONT) {
+		side = ourSide
+	}
+	was := r.will[opt] & r.do[opt] & side
+	switch cmd {
+	case WILL:
+		r.will[opt] |= side
+	case DO:
+		r.do[opt] |= side
+	default:
+		r.will[opt] &^= side
+		r.do[opt] &^= side
+	}
+	if now := r.will[opt] & r.do[opt] & side; now != was {
+		c.changed(opt, side == theirSide, now != 0)
+	}
+	switch opt {
+	case BIN:
+		c.setBinary(r.will[BIN]&r.do[BIN]&theirSide != 0)
+	case ECHO:
+		c.setRemoteEcho(r.will[ECHO]&r.do[ECHO]&theirSide != 0)
+		if c.wake != nil {
+			// for the OnRemoteEcho callback
+			notify(c.wake)
+		}
+	}
+}
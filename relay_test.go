@@ -0,0 +1,64 @@
+package gote
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a bytes.Buffer safe to write from the processing goroutine.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) Bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]byte(nil), s.b.Bytes()...)
+}
+
+func TestRelay(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+	var other syncBuffer
+	tel.SetRelay(&other)
+
+	sb := Subnegotiation(TTYPE, SEND, nil)
+	in := append([]byte{IAC, WILL, BIN, 'a', IAC, DO, TTYPE}, sb...)
+	server.Write(in)
+	b := make([]byte, 1)
+	_, err := ReadFull(tel, b)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(b))
+	time.Sleep(time.Duration(20) * time.Millisecond)
+	// passed on untouched, and not answered
+	assert.Equal(t, append([]byte{IAC, WILL, BIN, IAC, DO, TTYPE}, sb...), other.Bytes())
+	assert.Error(t, server.Expect([]byte{IAC}, time.Duration(50)*time.Millisecond))
+	assert.False(t, tel.Capabilities().Supports(FeatureBinary))
+
+	// the answer from the other side turns binary on
+	assert.NoError(t, tel.SendRawSequence(IAC, DO, BIN, IAC, WONT, TTYPE))
+	assert.NoError(t, server.Expect([]byte{IAC, DO, BIN, IAC, WONT, TTYPE}, time.Second))
+	assert.True(t, tel.Capabilities().Supports(FeatureBinary))
+	server.Write([]byte{IAC, WONT, BIN})
+	time.Sleep(time.Duration(20) * time.Millisecond)
+	assert.False(t, tel.Capabilities().Supports(FeatureBinary))
+
+	// back to answering
+	tel.SetRelay(nil)
+	err = server.Play(time.Second, fake.Step{Send: []byte{IAC, WILL, SGA}, Expect: []byte{IAC, DO, SGA}})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,88 @@
+package gote
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ResourceStats is what one or more connections hold on to, for capacity planning.
+type ResourceStats struct {
+	// Connections is the number of connections counted, which are still running.
+	Connections int
+	// Goroutines is the number of background goroutines still running.
+	Goroutines int
+	// BufferBytes is the capacity of the buffers held, including the pooled input
+	// ring and scratch buffers while the connection runs.
+	BufferBytes int
+	// Timers is the number of timers armed, for keepalives and read deadlines.
+	Timers int
+}
+
+// Add returns the sum of r and o, to aggregate over connections.
+func (r ResourceStats) Add(o ResourceStats) ResourceStats {
+	return ResourceStats{
+		Connections: r.Connections + o.Connections,
+		Goroutines:  r.Goroutines + o.Goroutines,
+		BufferBytes: r.BufferBytes + o.BufferBytes,
+		Timers:      r.Timers + o.Timers,
+	}
+}
+
+// ResourceStats returns what the connection holds on to right now.
+func (c *conn) ResourceStats() ResourceStats {
+	var r ResourceStats
+	r.Goroutines = int(atomic.LoadInt32(&c.running))
+	if r.Goroutines > 0 {
+		r.Connections = 1
+		// the ring and one scratch buffer for each of its ends
+		r.BufferBytes = ringSize + 2*scratchSize
+	}
+	r.BufferBytes += int(atomic.LoadInt32(&c.held))
+	if c.uLock != nil {
+		c.uLock.Lock()
+		r.BufferBytes += c.u.Cap()
+		c.uLock.Unlock()
+	}
+	r.Timers = int(atomic.LoadInt32(&c.timers))
+	return r
+}
+
+// newTimer starts a timer counted in ResourceStats, which stop must be called with.
+func (c *conn) newTimer(d time.Duration) *time.Timer {
+	atomic.AddInt32(&c.timers, 1)
+	return time.NewTimer(d)
+}
+
+// stopTimer stops a timer from newTimer.
+func (c *conn) stopTimer(t *time.Timer) {
+	t.Stop()
+	atomic.AddInt32(&c.timers, -1)
+}
+
+// ResourceStats returns the sum over the connections accepted that are still
+// running.
+func (l *Listener) ResourceStats() ResourceStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var r ResourceStats
+	for c := range l.conns {
+		r = r.Add(c.ResourceStats())
+	}
+	return r
+}
+
+// track adds a connection to those counted by ResourceStats, until it ends.
+// It must be called before the connection starts.
+func (l *Listener) track(c *conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns == nil {
+		l.conns = make(map[*conn]struct{})
+	}
+	l.conns[c] = struct{}{}
+	c.exited = func() {
+		l.mu.Lock()
+		delete(l.conns, c)
+		l.mu.Unlock()
+	}
+}
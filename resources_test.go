@@ -0,0 +1,86 @@
+package gote
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceStats(t *testing.T) {
+	l, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	var clients []net.Conn
+	for i := 0; i < 2; i++ {
+		nc, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer nc.Close()
+		clients = append(clients, nc)
+	}
+	a, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	r := a.ResourceStats()
+	assert.Equal(t, 1, r.Connections)
+	assert.Equal(t, 3, r.Goroutines)
+	assert.True(t, r.BufferBytes >= ringSize+2*scratchSize)
+	assert.Equal(t, 0, r.Timers)
+
+	// a waiting Read with a deadline holds a timer
+	a.SetReadDeadline(time.Now().Add(time.Second))
+	go a.Read(make([]byte, 1))
+	time.Sleep(time.Duration(20) * time.Millisecond)
+	assert.Equal(t, 1, a.ResourceStats().Timers)
+
+	total := l.ResourceStats()
+	assert.Equal(t, 2, total.Connections)
+	assert.Equal(t, 6, total.Goroutines)
+	assert.Equal(t, 1, total.Timers)
+
+	// ended connections drop out
+	a.Close()
+	<-a.Done()
+	time.Sleep(time.Duration(20) * time.Millisecond)
+	r = a.ResourceStats()
+	assert.Equal(t, 0, r.Connections)
+	assert.Equal(t, 0, r.Goroutines)
+	assert.Equal(t, 0, r.Timers)
+	assert.Equal(t, 1, l.ResourceStats().Connections)
+}
+
+func TestListener_Untrack(t *testing.T) {
+	l, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for i := 0; i < 5; i++ {
+		nc, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nc.Close()
+		<-c.Done()
+	}
+	// gone without ResourceStats being called
+	l.mu.Lock()
+	assert.Len(t, l.conns, 0)
+	l.mu.Unlock()
+}
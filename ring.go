@@ -0,0 +1,148 @@
+package gote
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ringSize is the capacity of the input ring, in bytes. It must be a power of two.
+const ringSize = 1 << 14
+
+// scratchSize is the size of the scratch buffers the goroutines at each end of the ring use.
+const scratchSize = 2048
+
+// Rings and scratch buffers are pooled across connections, so servers and clients
+// that churn through many connections reuse them instead of allocating new ones.
+var (
+	ringPool = sync.Pool{New: func() interface{} { return newRing(ringSize) }}
+	bufPool  = sync.Pool{New: func() interface{} { b := make([]byte, scratchSize); return &b }}
+)
+
+// ring is a single producer, single consumer byte queue between the socket reader
+// and the parser. The two sides never share a lock: the producer only advances
+// tail and the consumer only advances head, and each side wakes the other through
+// a one slot notification channel. It only covers the input side: from the
+// parser on, data goes through the upstream buffer Read shares under uLock.
+type ring struct {
+	// head and tail come first to keep them 64 bit aligned for atomic access
+	head uint64 // next byte to read, owned by the consumer
+	tail uint64 // next byte to write, owned by the producer
+
+	buf      []byte
+	mask     uint64
+	err      error  // set by the producer before closed
+	closed   uint32 // set once the producer is done
+	readable chan struct{}
+	writable chan struct{}
+	done     chan struct{} // closed when the consumer goes away
+	refs     int32         // users left before the ring goes back to the pool
+}
+
+// getRing returns an empty ring from the pool, to be shared by a producer and a
+// consumer which each call release once they are done with it.
+func getRing() *ring {
+	r := ringPool.Get().(*ring)
+	r.head, r.tail = 0, 0
+	r.err, r.closed = nil, 0
+	r.done = make(chan struct{})
+	r.refs = 2
+	select {
+	case <-r.readable:
+	default:
+	}
+	select {
+	case <-r.writable:
+	default:
+	}
+	return r
+}
+
+// release hands the ring back to the pool once both of its users are done.
+func (r *ring) release() {
+	if atomic.AddInt32(&r.refs, -1) == 0 {
+		ringPool.Put(r)
+	}
+}
+
+func newRing(size int) *ring {
+	return &ring{
+		buf:      make([]byte, size),
+		mask:     uint64(size - 1),
+		readable: make(chan struct{}, 1),
+		writable: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// write copies all of b into the ring, waiting for the consumer to make room
+// when it's full. It returns false if the consumer stopped first.
+func (r *ring) write(b []byte) bool {
+	for len(b) > 0 {
+		tail := r.tail
+		free := uint64(len(r.buf)) - (tail - atomic.LoadUint64(&r.head))
+		if free == 0 {
+			select {
+			case <-r.writable:
+				continue
+			case <-r.done:
+				return false
+			}
+		}
+		n := uint64(len(b))
+		if n > free {
+			n = free
+		}
+		start := tail & r.mask
+		m := uint64(copy(r.buf[start:], b[:n]))
+		copy(r.buf, b[m:n])
+		atomic.StoreUint64(&r.tail, tail+n)
+		b = b[n:]
+		notify(r.readable)
+	}
+	return true
+}
+
+// close marks the end of the input. The consumer gets err once the ring is drained.
+func (r *ring) close(err error) {
+	r.err = err
+	atomic.StoreUint32(&r.closed, 1)
+	notify(r.readable)
+}
+
+// read copies as much buffered input as fits into b without waiting. Once the
+// ring is closed and drained it returns the producer's error.
+func (r *ring) read(b []byte) (int, error) {
+	closed := atomic.LoadUint32(&r.closed) == 1
+	head := r.head
+	avail := atomic.LoadUint64(&r.tail) - head
+	if avail == 0 {
+		if closed {
+			return 0, r.err
+		}
+		return 0, nil
+	}
+	n := uint64(len(b))
+	if n > avail {
+		n = avail
+	}
+	start := head & r.mask
+	m := uint64(copy(b[:n], r.buf[start:]))
+	copy(b[m:n], r.buf)
+	atomic.StoreUint64(&r.head, head+n)
+	notify(r.writable)
+	return int(n), nil
+}
+
+// stop releases a producer waiting for room.
+func (r *ring) stop() {
+	close(r.done)
+}
+
+// notify signals ch without blocking. One pending signal is enough, since
+// the receiving side always drains everything available when woken.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,145 @@
+package gote
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	r := newRing(8)
+	failed := errors.New("failed")
+	go func() {
+		// more than the capacity, so the writer has to wait and wrap around
+		for i := 0; i < 10; i++ {
+			r.write([]byte{byte(i), byte(i), byte(i)})
+		}
+		r.close(failed)
+	}()
+
+	var got []byte
+	b := make([]byte, 5)
+	for {
+		n, err := r.read(b)
+		got = append(got, b[:n]...)
+		if err != nil {
+			assert.Equal(t, failed, err)
+			break
+		}
+		if n == 0 {
+			<-r.readable
+		}
+	}
+	assert.Len(t, got, 30)
+	for i := range got {
+		assert.Equal(t, byte(i/3), got[i])
+	}
+}
+
+func TestRing_Stop(t *testing.T) {
+	r := newRing(2)
+	done := make(chan bool)
+	go func() {
+		done <- r.write([]byte{1, 2, 3})
+	}()
+	r.stop()
+	assert.False(t, <-done)
+}
+
+// Results on a single CPU Xeon VM, go test -bench 'Input|Pipeline' -benchmem:
+//
+//	BenchmarkInputRing       234 ns/op  8745 MB/s     0 B/op  0 allocs/op
+//	BenchmarkInputChannel    633 ns/op  3235 MB/s  2048 B/op  1 allocs/op
+//	BenchmarkPipeline       2186 ns/op   937 MB/s     0 B/op  0 allocs/op
+//
+// With -cpu 4 the ring stays at 241 ns/op while the channel goes to 3022 ns/op.
+
+// benchmarkInput sends b.N chunks through the socket-to-parser hand off.
+func benchmarkInput(b *testing.B, send func([]byte), closeInput func(), recv func([]byte) (int, error)) {
+	chunk := make([]byte, 2048)
+	out := make([]byte, 2048)
+	b.SetBytes(int64(len(chunk)))
+	go func() {
+		for i := 0; i < b.N; i++ {
+			send(chunk)
+		}
+		closeInput()
+	}()
+	for {
+		if _, err := recv(out); err != nil {
+			return
+		}
+	}
+}
+
+func BenchmarkInputRing(b *testing.B) {
+	r := newRing(ringSize)
+	benchmarkInput(b, func(p []byte) { r.write(p) }, func() { r.close(io.EOF) },
+		func(p []byte) (int, error) {
+			n, err := r.read(p)
+			if n == 0 && err == nil {
+				<-r.readable
+			}
+			return n, err
+		})
+}
+
+// BenchmarkInputChannel is the channel of copied chunks the ring replaced.
+func BenchmarkInputChannel(b *testing.B) {
+	updates := make(chan chunk, 2048)
+	benchmarkInput(b, func(p []byte) {
+		u := make([]byte, len(p))
+		copy(u, p)
+		updates <- chunk{b: u}
+	}, func() { updates <- chunk{err: io.EOF} },
+		func(p []byte) (int, error) {
+			u := <-updates
+			return copy(p, u.b), u.err
+		})
+}
+
+// BenchmarkPipeline sends b.N chunks from the socket through to Read, which on
+// top of the ring includes the upstream buffer Read and the parser share under
+// uLock.
+func BenchmarkPipeline(b *testing.B) {
+	client, server := net.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+	chunk := make([]byte, 2048)
+	out := make([]byte, 2048)
+	b.SetBytes(int64(len(chunk)))
+	go func() {
+		for i := 0; i < b.N; i++ {
+			if _, err := server.Write(chunk); err != nil {
+				return
+			}
+		}
+	}()
+	for left := b.N * len(chunk); left > 0; {
+		n, err := tel.Read(out)
+		if err != nil {
+			b.Fatal(err)
+		}
+		left -= n
+	}
+}
+
+func TestRing_Pool(t *testing.T) {
+	r := getRing()
+	r.write([]byte{1, 2, 3})
+	r.close(io.EOF)
+	r.stop()
+	r.release()
+	r.release()
+
+	// whatever comes out of the pool is empty
+	r = getRing()
+	n, err := r.read(make([]byte, 3))
+	assert.Equal(t, 0, n)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), r.refs)
+}
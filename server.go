@@ -0,0 +1,237 @@
+package gote
+
+import (
+	"net"
+	"sync"
+)
+
+// Listener accepts telnet connections, for writing telnet servers. Connections it
+// accepts negotiate from the server's side: they offer and request the configured
+// options as soon as they are accepted, and keep track of each option's state so
+// that agreeing to an offer doesn't start a negotiation loop.
+type Listener struct {
+	// Will lists the options the server offers to each new connection with
+	// IAC WILL. They are also accepted when a client asks for them with DO.
+	// Listen sets it to SGA.
+	Will []byte
+	// Do lists the options the server asks each new connection to enable with
+	// IAC DO. They are also accepted when a client offers them with WILL.
+	Do []byte
+	// MaxReplies caps the negotiation replies of each connection, as
+	// Dialer.MaxReplies does.
+	MaxReplies int
+
+	l net.Listener
+
+	mu    sync.Mutex
+	conns map[*conn]struct{} // for ResourceStats
+}
+
+// Listen listens on a network address, like net.Listen, for telnet connections.
+func Listen(network, address string) (*Listener, error) {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewListener(l), nil
+}
+
+// NewListener returns a Listener accepting telnet connections from l.
+func NewListener(l net.Listener) *Listener {
+	return &Listener{Will: []byte{SGA}, l: l}
+}
+
+// Accept waits for the next connection, sends it the initial negotiation and
+// returns it. A client that goes away before the negotiation could be sent is
+// closed and skipped, so errors only come from the underlying listener.
+func (l *Listener) Accept() (Connection, error) {
+	for {
+		nc, err := l.l.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if c, err := l.serve(nc); err == nil {
+			return c, nil
+		}
+	}
+}
+
+// Close stops listening. Connections already accepted stay open.
+func (l *Listener) Close() error {
+	return l.l.Close()
+}
+
+// Addr returns the address listened on.
+func (l *Listener) Addr() net.Addr {
+	return l.l.Addr()
+}
+
+// serve starts a server side connection on nc.
+func (l *Listener) serve(nc net.Conn) (Connection, error) {
+	s := newServerState(l.Will, l.Do)
+	c := &conn{server: s, maxReplies: l.MaxReplies}
+	// written before the processing starts, so nothing else writes replies yet
+	if volley := s.volley(); len(volley) > 0 {
+		n, err := nc.Write(volley)
+		c.countOut(n, 0)
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	l.track(c)
+	c.start(nc)
+	return c, nil
+}
+
+// optState is the state of one side of an option.
+type optState byte
+
+const (
+	optNo optState = iota
+	optYes
+	// optWantYes means the server asked for the option and waits for an answer.
+	optWantYes
+)
+
+// serverState is the negotiation state of a server side connection, owned by the
+// processing goroutine once the connection is started.
+type serverState struct {
+	will map[byte]bool // options the server may enable on its side
+	do   map[byte]bool // options the server lets the client enable
+	us   map[byte]optState
+	them map[byte]optState
+	// the configured lists, in order, for the initial volley
+	offers, requests []byte
+}
+
+func newServerState(will, do []byte) *serverState {
+	s := &serverState{
+		will:     make(map[byte]bool),
+		do:       make(map[byte]bool),
+		us:       make(map[byte]optState),
+		them:     make(map[byte]optState),
+		offers:   will,
+		requests: do,
+	}
+	for _, opt := range will {
+		s.will[opt] = true
+	}
+	for _, opt := range do {
+		s.do[opt] = true
+	}
+	return s
+}
+
+// volley returns the initial offers and requests, and marks them as waiting.
+func (s *serverState) volley() []byte {
+	var b []byte
+	for _, opt := range s.offers {
+		s.us[opt] = optWantYes
+		b = append(b, IAC, WILL, opt)
+	}
+	for _, opt := range s.requests {
+		s.them[opt] = optWantYes
+		b = append(b, IAC, DO, opt)
+	}
+	return b
+}
+
+// negotiate answers a negotiation command from the client. Requests to enter a
+// state the option is already in are not answered, as RFC 854 asks, and requests
+// whose answer is dropped by the reply limit leave the option as it was.
+func (s *serverState) negotiate(c *conn, cmd, opt byte) {
+	h := c.optionHandler(opt)
+	on, off := false, false
+	wasUs, wasThem := s.us[opt], s.them[opt]
+	switch cmd {
+	case DO:
+		switch s.us[opt] {
+		case optWantYes:
+			s.us[opt] = optYes
+			on = true
+		case optNo:
+			if s.accept(h, cmd, s.will[opt]) {
+				if c.reply(WILL, opt) {
+					s.us[opt] = optYes
+					on = true
+				}
+			} else {
+				c.reply(WONT, opt)
+			}
+		}
+	case DONT:
+		switch s.us[opt] {
+		case optYes:
+			if c.reply(WONT, opt) {
+				s.us[opt] = optNo
+				off = true
+			}
+		case optWantYes:
+			// the client refused the offer
+			s.us[opt] = optNo
+			off = true
+		}
+	case WILL:
+		switch s.them[opt] {
+		case optWantYes:
+			s.them[opt] = optYes
+			on = true
+		case optNo:
+			if s.accept(h, cmd, s.do[opt]) {
+				if c.reply(DO, opt) {
+					s.them[opt] = optYes
+					on = true
+				}
+			} else {
+				c.reply(DONT, opt)
+			}
+		}
+	case WONT:
+		switch s.them[opt] {
+		case optYes:
+			if c.reply(DONT, opt) {
+				s.them[opt] = optNo
+				off = true
+			}
+		case optWantYes:
+			s.them[opt] = optNo
+			off = true
+		}
+	}
+	switch {
+	case on:
+		c.changed(opt, cmd == WILL, true)
+	case off && (cmd == WONT && wasThem == optYes || cmd == DONT && wasUs == optYes):
+		c.changed(opt, cmd == WONT, false)
+	}
+	var sides optSides
+	if s.us[opt] == optYes {
+		sides |= ourSide
+	}
+	if s.them[opt] == optYes {
+		sides |= theirSide
+	}
+	c.setSides(opt, sides)
+	if opt == BIN {
+		c.setBinary(s.them[BIN] == optYes)
+	}
+	if h == nil {
+		return
+	}
+	switch {
+	case on:
+		c.later(func() { h.Enabled(handlerConn{c}, cmd) })
+	case off:
+		c.later(func() { h.Disabled(handlerConn{c}, cmd) })
+	}
+}
+
+// accept decides on a request for an option that is off, asking its handler if
+// there is one and going by the configured lists otherwise.
+func (s *serverState) accept(h OptionHandler, cmd byte, listed bool) bool {
+	if h != nil {
+		return h.Accept(cmd)
+	}
+	return listed
+}
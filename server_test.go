@@ -0,0 +1,141 @@
+package gote
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Negotiation(t *testing.T) {
+	l := &Listener{Will: []byte{SGA, ECHO}, Do: []byte{BIN}}
+	server, client := fake.Pipe()
+	c, err := l.serve(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = client.Play(time.Second,
+		fake.Step{Expect: []byte{IAC, WILL, SGA, IAC, WILL, ECHO, IAC, DO, BIN}},
+		// agreeing to the offers and requests isn't answered again,
+		// while refusals and unknown options are
+		fake.Step{
+			Send:   []byte{IAC, DO, SGA, IAC, DONT, ECHO, IAC, WILL, BIN, IAC, DO, 24, IAC, WILL, 31},
+			Expect: []byte{IAC, WONT, 24, IAC, DONT, 31},
+		},
+		// ECHO was refused, so asking for it now turns it on
+		fake.Step{Send: []byte{IAC, DO, ECHO}, Expect: []byte{IAC, WILL, ECHO}},
+		// turning off what is on is acknowledged once
+		fake.Step{Send: []byte{IAC, DONT, SGA, IAC, DONT, SGA, IAC, WONT, BIN}, Expect: []byte{IAC, WONT, SGA, IAC, DONT, BIN}},
+	)
+	assert.NoError(t, err)
+
+	// data is escaped like on the client side
+	client.Write([]byte{'h', 'i', IAC, IAC})
+	b := make([]byte, 3)
+	_, err = ReadFull(c, b)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{'h', 'i', IAC}, b)
+	c.Write([]byte{IAC})
+	assert.NoError(t, client.Expect([]byte{IAC, IAC}, time.Second))
+}
+
+func TestServer_VolleyStats(t *testing.T) {
+	l := &Listener{Will: []byte{SGA}, Do: []byte{BIN}}
+	server, client := fake.Pipe()
+	c, err := l.serve(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assert.NoError(t, client.Expect([]byte{IAC, WILL, SGA, IAC, DO, BIN}, time.Second))
+	assert.Equal(t, uint64(6), c.Stats().WireOut)
+}
+
+func TestServer_Binary(t *testing.T) {
+	s := newServerState(nil, []byte{BIN})
+	s.volley()
+	tel := &conn{
+		i:      bytes.NewBuffer(nil),
+		u:      bytes.NewBuffer(nil),
+		server: s,
+	}
+	tel.i.Write([]byte{IAC, WILL, BIN})
+	tel.parse()
+	assert.True(t, tel.remoteBinary())
+	assert.Empty(t, tel.replies)
+	tel.i.Write([]byte{IAC, WONT, BIN})
+	tel.parse()
+	assert.False(t, tel.remoteBinary())
+	assert.Equal(t, []byte{IAC, DONT, BIN}, tel.replies)
+}
+
+func TestListen(t *testing.T) {
+	l, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		c.Write([]byte("welcome"))
+		time.Sleep(time.Duration(500) * time.Millisecond)
+		c.Close()
+	}()
+
+	c, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// the client agrees to SGA, so the only thing left is the data
+	b := make([]byte, 7)
+	_, err = ReadFull(c, b)
+	assert.NoError(t, err)
+	assert.Equal(t, "welcome", string(b))
+}
+
+// pipeListener hands out the server ends of fake pipes.
+type pipeListener struct {
+	conns chan net.Conn
+}
+
+func (p pipeListener) Accept() (net.Conn, error) {
+	nc, ok := <-p.conns
+	if !ok {
+		return nil, io.EOF
+	}
+	return nc, nil
+}
+
+func (p pipeListener) Close() error   { return nil }
+func (p pipeListener) Addr() net.Addr { return fake.Addr("server") }
+
+func TestListener_AcceptAfterReset(t *testing.T) {
+	p := pipeListener{conns: make(chan net.Conn, 2)}
+	l := NewListener(p)
+	// the first client is gone before the negotiation is sent
+	gone, server := fake.Pipe()
+	gone.Close()
+	p.conns <- server
+	client, server := fake.Pipe()
+	p.conns <- server
+	close(p.conns)
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assert.NoError(t, client.Expect([]byte{IAC, WILL, SGA}, time.Second))
+	_, err = l.Accept()
+	assert.Equal(t, io.EOF, err)
+}
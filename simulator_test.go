@@ -0,0 +1,220 @@
+package gote
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+// The negotiation simulator runs this package as both the client and the server
+// of a connection, with random policies on both ends, and checks that the two
+// converge without looping and agree on the state of every option. Failing cases
+// are shrunk before being reported.
+
+// simOptions are the options the simulator picks from: ones with built in client
+// handlers, the hard coded SGA, and one nothing knows about.
+var simOptions = []byte{BIN, ECHO, SGA, NAWS, 200}
+
+// simPolicy is a client side handler agreeing to either side of its option.
+type simPolicy struct {
+	BaseOption
+	Will, Do bool
+}
+
+func (p simPolicy) Accept(cmd byte) bool {
+	return cmd == WILL && p.Will || cmd == DO && p.Do
+}
+
+// simCase is one run of the simulator.
+type simCase struct {
+	// Will and Do configure the Listener.
+	Will, Do []byte
+	// Client holds the handlers registered on the client, by option.
+	Client map[byte]simPolicy
+	// Requests are sent by the client as soon as it starts, without going
+	// through its own state, like a peer asking for options of its own.
+	Requests [][2]byte
+}
+
+func (s simCase) String() string {
+	return fmt.Sprintf("Will %v, Do %v, client %v, requests %v", s.Will, s.Do, s.Client, s.Requests)
+}
+
+func randomCase(r *rand.Rand) simCase {
+	pick := func() []byte {
+		var b []byte
+		for _, opt := range simOptions {
+			if r.Intn(2) == 0 {
+				b = append(b, opt)
+			}
+		}
+		return b
+	}
+	s := simCase{Will: pick(), Do: pick(), Client: make(map[byte]simPolicy)}
+	for _, opt := range pick() {
+		s.Client[opt] = simPolicy{Will: r.Intn(2) == 0, Do: r.Intn(2) == 0}
+	}
+	for i := r.Intn(4); i > 0; i-- {
+		cmd := []byte{WILL, DO}[r.Intn(2)]
+		s.Requests = append(s.Requests, [2]byte{cmd, simOptions[r.Intn(len(simOptions))]})
+	}
+	return s
+}
+
+// simulate runs s and returns what went wrong, if anything.
+func simulate(s simCase) error {
+	client, server := fake.Pipe()
+	cl := &conn{}
+	for opt, p := range s.Client {
+		cl.RegisterOption(opt, p)
+	}
+	l := &Listener{Will: s.Will, Do: s.Do}
+	sc, err := l.serve(server)
+	if err != nil {
+		return err
+	}
+	srv := sc.(*conn)
+	cl.start(client)
+	for _, req := range s.Requests {
+		cl.SendRawSequence(IAC, req[0], req[1])
+	}
+
+	// settled once both ends have read all the other sent, and answered nothing more
+	settled := false
+	var last [4]uint64
+	for round, stable := 0, 0; round < 100 && !settled; round++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		cl.Flush(ctx)
+		srv.Flush(ctx)
+		cancel()
+		a, b := cl.Stats(), srv.Stats()
+		now := [4]uint64{a.WireIn, a.WireOut, b.WireIn, b.WireOut}
+		if now == last && a.WireIn == b.WireOut && b.WireIn == a.WireOut {
+			stable++
+		} else {
+			stable = 0
+		}
+		settled = stable == 3
+		last = now
+		time.Sleep(time.Millisecond)
+	}
+	cl.Close()
+	srv.Close()
+	<-cl.Done()
+	<-srv.Done()
+	if !settled {
+		return fmt.Errorf("negotiation never settled")
+	}
+	for _, c := range []*conn{cl, srv} {
+		for opt, st := range c.Stats().Options {
+			if st.Dropped > 0 {
+				return fmt.Errorf("%d replies for option %d dropped, negotiation looped", st.Dropped, opt)
+			}
+		}
+	}
+
+	// the goroutines are gone, so the server state can be read
+	for _, opt := range simOptions {
+		us, them := srv.server.us[opt], srv.server.them[opt]
+		if us == optWantYes || them == optWantYes {
+			return fmt.Errorf("option %d still waiting for an answer", opt)
+		}
+		var want optSides
+		if _, ok := cl.optionHandler(opt).(simPolicy); ok || opt == BIN || opt == ECHO {
+			want = cl.sides(opt)
+		} else if opt == SGA && srv.server.will[SGA] {
+			// agreed to without keeping track of it
+			want = theirSide
+		}
+		var got optSides
+		if us == optYes {
+			got |= theirSide
+		}
+		if them == optYes {
+			got |= ourSide
+		}
+		if got != want {
+			return fmt.Errorf("option %d: client has %d on, server %d", opt, want, got)
+		}
+	}
+	return nil
+}
+
+// shrink removes everything from s it can while it keeps failing.
+func shrink(s simCase, fails func(simCase) bool) simCase {
+	for changed := true; changed; {
+		changed = false
+		for _, smaller := range smallerCases(s) {
+			if fails(smaller) {
+				s, changed = smaller, true
+				break
+			}
+		}
+	}
+	return s
+}
+
+// smallerCases returns the cases with one thing less in them than s.
+func smallerCases(s simCase) []simCase {
+	without := func(b []byte, i int) []byte {
+		return append(append([]byte(nil), b[:i]...), b[i+1:]...)
+	}
+	var cases []simCase
+	for i := range s.Will {
+		c := s
+		c.Will = without(s.Will, i)
+		cases = append(cases, c)
+	}
+	for i := range s.Do {
+		c := s
+		c.Do = without(s.Do, i)
+		cases = append(cases, c)
+	}
+	for opt := range s.Client {
+		c := s
+		c.Client = make(map[byte]simPolicy)
+		for o, p := range s.Client {
+			if o != opt {
+				c.Client[o] = p
+			}
+		}
+		cases = append(cases, c)
+	}
+	for i := range s.Requests {
+		c := s
+		c.Requests = append(append([][2]byte(nil), s.Requests[:i]...), s.Requests[i+1:]...)
+		cases = append(cases, c)
+	}
+	return cases
+}
+
+func TestSimulator(t *testing.T) {
+	n := 200
+	if testing.Short() {
+		n = 20
+	}
+	seed := time.Now().UnixNano()
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		s := randomCase(r)
+		if err := simulate(s); err != nil {
+			min := shrink(s, func(s simCase) bool { return simulate(s) != nil })
+			t.Fatalf("seed %d: %v\nwith %v\nshrunk to %v: %v", seed, err, s, min, simulate(min))
+		}
+	}
+}
+
+func TestSimulator_Shrink(t *testing.T) {
+	s := simCase{Will: []byte{SGA, ECHO}, Do: []byte{BIN}, Client: map[byte]simPolicy{200: {Will: true}}}
+	// everything goes but the one thing that fails
+	s = shrink(s, func(s simCase) bool {
+		_, ok := s.Client[200]
+		return ok
+	})
+	assert.Equal(t, simCase{Client: map[byte]simPolicy{200: {Will: true}}}, s)
+}
@@ -0,0 +1,212 @@
+package gote
+
+import "time"
+
+// gapBounds are the upper bounds of the gap histogram buckets. Gaps longer than
+// the last one go into a final, unbounded bucket.
+var gapBounds = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+}
+
+// Stats is a snapshot of a connection's counters.
+type Stats struct {
+	// Ignored counts the commands received from the server that were consumed
+	// without any effect, because nothing handles them, keyed by command byte.
+	// Subnegotiations for options without a handler are counted under SB.
+	// OnIgnored reports them as they come in.
+	Ignored map[byte]uint64
+	// Gaps is a histogram of the pauses between consecutive arrivals of data from
+	// the server, from a millisecond up. Slow serial consoles and fast VTYs show
+	// very different shapes, which is useful for tuning quiet periods per device.
+	Gaps []GapBucket
+	// GapSum is the total of all the gaps counted in Gaps.
+	GapSum time.Duration
+	// WireIn and WireOut count the bytes read from and written to the network,
+	// including escapes, negotiation and subnegotiation.
+	WireIn, WireOut uint64
+	// DataIn counts the bytes of application data decoded for Read, and DataOut
+	// the bytes passed to successful writes, before escaping and newline translation.
+	DataIn, DataOut uint64
+	// Options counts the traffic of each option the server brought up, keyed by
+	// option byte.
+	Options map[byte]OptionStats
+}
+
+// OptionStats counts the traffic of one option.
+type OptionStats struct {
+	// Negotiations counts the WILL, WONT, DO and DONT received for the option.
+	Negotiations uint64
+	// Subnegotiations counts the complete subnegotiations received for it.
+	Subnegotiations uint64
+	// Dropped counts the replies and subnegotiation answers left out by the reply limit.
+	Dropped uint64
+}
+
+// Overhead returns how many more bytes went over the network than the data they
+// carried, in each direction. On a metered link this is the cost of telnet itself.
+func (s Stats) Overhead() (in, out uint64) {
+	if s.WireIn > s.DataIn {
+		in = s.WireIn - s.DataIn
+	}
+	if s.WireOut > s.DataOut {
+		out = s.WireOut - s.DataOut
+	}
+	return in, out
+}
+
+// GapBucket counts the gaps no longer than Max, and longer than the Max of the
+// bucket before it. The last bucket has a Max of zero and counts everything longer.
+type GapBucket struct {
+	Max   time.Duration
+	Count uint64
+}
+
+// GapQuantile returns the upper bound of the bucket holding the q quantile of the
+// observed gaps, for q between 0 and 1. It returns zero if no gaps were observed,
+// and -1 if the quantile falls into the unbounded bucket.
+func (s Stats) GapQuantile(q float64) time.Duration {
+	var total uint64
+	for _, b := range s.Gaps {
+		total += b.Count
+	}
+	if total == 0 {
+		return 0
+	}
+	want := uint64(q*float64(total) + 0.5)
+	if want == 0 {
+		want = 1
+	}
+	var n uint64
+	for _, b := range s.Gaps {
+		n += b.Count
+		if n >= want {
+			if b.Max == 0 {
+				return -1
+			}
+			return b.Max
+		}
+	}
+	return -1
+}
+
+// Stats returns a snapshot of the connection's counters.
+func (c *conn) Stats() Stats {
+	c.sLock.Lock()
+	defer c.sLock.Unlock()
+	s := Stats{
+		Ignored: make(map[byte]uint64, len(c.ignored)),
+		Gaps:    make([]GapBucket, len(gapBounds)+1),
+		Options: make(map[byte]OptionStats, len(c.optStats)),
+	}
+	for cmd, n := range c.ignored {
+		s.Ignored[cmd] = n
+	}
+	for opt, o := range c.optStats {
+		s.Options[opt] = o
+	}
+	s.GapSum = c.gapSum
+	s.WireIn, s.WireOut = c.wireIn, c.wireOut
+	s.DataIn, s.DataOut = c.dataIn, c.dataOut
+	for i := range s.Gaps {
+		if i < len(gapBounds) {
+			s.Gaps[i].Max = gapBounds[i]
+		}
+		if c.gaps != nil {
+			s.Gaps[i].Count = c.gaps[i]
+		}
+	}
+	return s
+}
+
+// OnIgnored sets the callback for ignored commands.
+func (c *conn) OnIgnored(fn func(cmd byte)) {
+	c.cLock.Lock()
+	c.onIgnored = fn
+	c.cLock.Unlock()
+}
+
+// ignore counts a command that was dropped, and queues the OnIgnored callback.
+func (c *conn) ignore(cmd byte) {
+	c.sLock.Lock()
+	if c.ignored == nil {
+		c.ignored = make(map[byte]uint64)
+	}
+	c.ignored[cmd]++
+	c.sLock.Unlock()
+	c.cLock.Lock()
+	fn := c.onIgnored
+	c.cLock.Unlock()
+	if fn != nil {
+		c.later(func() { fn(cmd) })
+	}
+}
+
+// countOption adds to the counters of an option.
+func (c *conn) countOption(opt byte, add OptionStats) {
+	c.sLock.Lock()
+	defer c.sLock.Unlock()
+	if c.optStats == nil {
+		c.optStats = make(map[byte]OptionStats)
+	}
+	o := c.optStats[opt]
+	o.Negotiations += add.Negotiations
+	o.Subnegotiations += add.Subnegotiations
+	o.Dropped += add.Dropped
+	c.optStats[opt] = o
+}
+
+// countIn adds to the byte counts of what came in from the network.
+func (c *conn) countIn(wire, data int) {
+	c.sLock.Lock()
+	c.wireIn += uint64(wire)
+	c.dataIn += uint64(data)
+	c.sLock.Unlock()
+}
+
+// countOut adds to the byte counts of what went out to the network.
+func (c *conn) countOut(wire, data int) {
+	c.sLock.Lock()
+	c.wireOut += uint64(wire)
+	c.dataOut += uint64(data)
+	c.sLock.Unlock()
+}
+
+// send writes telnet commands to the network, counting them.
+func (c *conn) send(b []byte) error {
+	n, err := c.Conn.Write(b)
+	c.countOut(n, 0)
+	return err
+}
+
+// arrived records the gap since the previous arrival of data. It is only called
+// from the goroutine reading the socket.
+func (c *conn) arrived(now time.Time) {
+	last := c.lastArrival
+	c.lastArrival = now
+	if last.IsZero() {
+		return
+	}
+	gap := now.Sub(last)
+	i := 0
+	for i < len(gapBounds) && gap > gapBounds[i] {
+		i++
+	}
+	c.sLock.Lock()
+	if c.gaps == nil {
+		c.gaps = make([]uint64, len(gapBounds)+1)
+	}
+	c.gaps[i]++
+	c.gapSum += gap
+	c.sLock.Unlock()
+}
@@ -0,0 +1,111 @@
+package gote
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats_Ignored(t *testing.T) {
+	tel := &conn{
+		i: bytes.NewBuffer(nil),
+		u: bytes.NewBuffer(nil),
+	}
+	tel.RegisterCommand(AYT, func(byte) error { return nil })
+	tel.i.Write([]byte{IAC, NOP, IAC, AYT, IAC, 100, IAC, NOP})
+	tel.parse()
+
+	assert.Equal(t, map[byte]uint64{NOP: 2, 100: 1}, tel.Stats().Ignored)
+	// snapshots don't change later
+	s := tel.Stats()
+	tel.i.Write([]byte{IAC, NOP})
+	tel.parse()
+	assert.Equal(t, uint64(2), s.Ignored[NOP])
+}
+
+func TestStats_OnIgnored(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	ignored := make(chan byte, 4)
+	tel.OnIgnored(func(cmd byte) {
+		// outside of the parsing pass, so the connection can be used
+		tel.TryRead(make([]byte, 1))
+		ignored <- cmd
+	})
+	tel.start(client)
+	defer tel.Close()
+
+	server.Write([]byte{IAC, NOP, 'a', IAC, SB, 200, 1, IAC, SE})
+	for _, expected := range []byte{NOP, SB} {
+		select {
+		case cmd := <-ignored:
+			assert.Equal(t, expected, cmd)
+		case <-time.After(time.Second):
+			t.Fatal("no callback")
+		}
+	}
+}
+
+func TestStats_Gaps(t *testing.T) {
+	tel := &conn{}
+	assert.Equal(t, time.Duration(0), tel.Stats().GapQuantile(0.5))
+
+	now := time.Now()
+	for _, d := range []time.Duration{0, 500 * time.Microsecond, 3 * time.Millisecond, 4 * time.Millisecond, 10 * time.Second} {
+		now = now.Add(d)
+		tel.arrived(now)
+	}
+	s := tel.Stats()
+	assert.Len(t, s.Gaps, len(gapBounds)+1)
+	assert.Equal(t, uint64(1), s.Gaps[0].Count)
+	assert.Equal(t, uint64(2), s.Gaps[2].Count)
+	assert.Equal(t, GapBucket{Max: 0, Count: 1}, s.Gaps[len(gapBounds)])
+	assert.Equal(t, 10*time.Second+7500*time.Microsecond, s.GapSum)
+	assert.Equal(t, time.Millisecond, s.GapQuantile(0))
+	assert.Equal(t, 5*time.Millisecond, s.GapQuantile(0.5))
+	assert.Equal(t, time.Duration(-1), s.GapQuantile(1))
+}
+
+func TestStats_Bytes(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	// 5 bytes of data in 11, and a DO to answer
+	server.Write([]byte{'a', IAC, IAC, 'b', IAC, WILL, ECHO, IAC, NOP, 'c', 'd'})
+	b := make([]byte, 5)
+	_, err := ReadFull(tel, b)
+	assert.NoError(t, err)
+	assert.NoError(t, server.Expect([]byte{IAC, DO, ECHO}, time.Second))
+	// 2 bytes of data in 3
+	tel.Write([]byte{IAC, 'x'})
+	assert.NoError(t, server.Expect([]byte{IAC, IAC, 'x'}, time.Second))
+
+	s := tel.Stats()
+	assert.Equal(t, uint64(11), s.WireIn)
+	assert.Equal(t, uint64(5), s.DataIn)
+	assert.Equal(t, uint64(6), s.WireOut)
+	assert.Equal(t, uint64(2), s.DataOut)
+	in, out := s.Overhead()
+	assert.Equal(t, uint64(6), in)
+	assert.Equal(t, uint64(4), out)
+}
+
+func TestStats_Options(t *testing.T) {
+	tel := &conn{
+		i: bytes.NewBuffer(nil),
+		u: bytes.NewBuffer(nil),
+	}
+	for i := 0; i < defaultMaxReplies+2; i++ {
+		tel.i.Write([]byte{IAC, DO, LOG})
+	}
+	tel.i.Write([]byte{IAC, SB, LOG, 1, IAC, SE})
+	tel.parse()
+	assert.Equal(t, map[byte]OptionStats{
+		LOG: {Negotiations: defaultMaxReplies + 2, Subnegotiations: 1, Dropped: 2},
+	}, tel.Stats().Options)
+}
@@ -0,0 +1,73 @@
+package gote
+
+import (
+	"errors"
+)
+
+// maxSubnegotiation is the most input buffered while waiting for the IAC SE that
+// ends a subnegotiation.
+const maxSubnegotiation = 1 << 16
+
+// ErrSubnegotiationTooLong fails a connection whose server sends a subnegotiation
+// that doesn't end within 64KB.
+var ErrSubnegotiationTooLong = errors.New("gote: subnegotiation too long")
+
+// Subnegotiation consumes an IAC SB <opt> ... IAC SE sequence once it is complete,
+// and passes its payload to the option's handler. Subnegotiation for options
+// without a handler is counted as ignored, under SB. An IAC followed by anything
+// but IAC or SE inside the payload is a protocol error; the subnegotiation is taken
+// to end before it, and the stream continues at that IAC.
+func (c *conn) subnegotiation(buf []byte) {
+	if len(buf) < 3 {
+		return
+	}
+	payload := c.sb[:0]
+	end := -1
+	for i := 3; i < len(buf); i++ {
+		if buf[i] != IAC {
+			payload = append(payload, buf[i])
+			continue
+		}
+		if i+1 == len(buf) {
+			break
+		}
+		if buf[i+1] == IAC {
+			payload = append(payload, IAC)
+			i++
+			continue
+		}
+		end = i
+		if buf[i+1] == SE {
+			end = i + 2
+		}
+		break
+	}
+	c.sb = payload
+	if end == -1 {
+		if len(buf) > maxSubnegotiation {
+			c.fail(ErrSubnegotiationTooLong)
+			// nothing more of the input is wanted
+			c.i.Reset()
+		}
+		return
+	}
+	opt := buf[2]
+	c.countOption(opt, OptionStats{Subnegotiations: 1})
+	seq := c.i.Next(end)
+	if c.relayed(seq) {
+		return
+	}
+
+	h := c.optionHandler(opt)
+	if h == nil {
+		c.ignore(SB)
+		return
+	}
+	// payload is scratch, reused by the next subnegotiation
+	payload = append([]byte(nil), payload...)
+	c.later(func() {
+		if err := h.Subnegotiation(handlerConn{c}, payload); err != nil {
+			c.fail(err)
+		}
+	})
+}
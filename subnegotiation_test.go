@@ -0,0 +1,86 @@
+package gote
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// payloadOption records the subnegotiation payloads it receives.
+type payloadOption struct {
+	BaseOption
+	payloads [][]byte
+	err      error
+}
+
+func (o *payloadOption) Subnegotiation(c Connection, payload []byte) error {
+	o.payloads = append(o.payloads, append([]byte(nil), payload...))
+	return o.err
+}
+
+func TestSubnegotiation_Dispatch(t *testing.T) {
+	tel := &conn{
+		i: bytes.NewBuffer(nil),
+		u: bytes.NewBuffer(nil),
+	}
+	o := &payloadOption{}
+	tel.RegisterOption(24, o)
+
+	// split up, with an escaped IAC in the payload
+	tel.i.Write([]byte{'a', IAC, SB, 24, 0, 'x', IAC})
+	tel.parse()
+	tel.callbacks()
+	assert.Empty(t, o.payloads)
+	tel.i.Write([]byte{IAC, 't', IAC})
+	tel.parse()
+	tel.callbacks()
+	assert.Empty(t, o.payloads)
+	tel.i.Write([]byte{SE, 'b'})
+	tel.parse()
+	tel.callbacks()
+	assert.Equal(t, [][]byte{{0, 'x', IAC, 't'}}, o.payloads)
+	assert.Equal(t, "ab", tel.u.String())
+
+	// an IAC that isn't escaped or SE ends the payload early
+	tel.i.Write([]byte{IAC, SB, 24, 1, IAC, NOP, 'c'})
+	tel.parse()
+	tel.callbacks()
+	assert.Equal(t, []byte{1}, o.payloads[1])
+	assert.Equal(t, "abc", tel.u.String())
+
+	// options without a handler are counted and dropped
+	tel.i.Write([]byte{IAC, SB, 31, 0, 80, 0, 24, IAC, SE, 'd'})
+	tel.parse()
+	tel.callbacks()
+	assert.Equal(t, "abcd", tel.u.String())
+	assert.Equal(t, map[byte]uint64{NOP: 1, SB: 1}, tel.Stats().Ignored)
+}
+
+func TestSubnegotiation_Errors(t *testing.T) {
+	tel := &conn{
+		i:     bytes.NewBuffer(nil),
+		u:     bytes.NewBuffer(nil),
+		eLock: &sync.Mutex{},
+	}
+	failure := errors.New("bad payload")
+	tel.RegisterOption(24, &payloadOption{err: failure})
+	tel.i.Write([]byte{IAC, SB, 24, IAC, SE})
+	tel.parse()
+	tel.callbacks()
+	assert.Equal(t, failure, tel.lastError)
+
+	tel = &conn{
+		i:     bytes.NewBuffer(nil),
+		u:     bytes.NewBuffer(nil),
+		eLock: &sync.Mutex{},
+	}
+	tel.i.Write([]byte{IAC, SB, 24})
+	tel.i.Write(make([]byte, maxSubnegotiation))
+	tel.parse()
+	tel.callbacks()
+	assert.Equal(t, ErrSubnegotiationTooLong, tel.lastError)
+	assert.Equal(t, 0, tel.i.Len())
+}
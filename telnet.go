@@ -4,52 +4,77 @@ package gote
 
 import (
 	"bytes"
-	"fmt"
+	"context"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Commands
 const (
-	IAC  = byte(255)
-	DONT = byte(254)
-	DO   = byte(253)
-	WONT = byte(252)
-	WILL = byte(251)
-	SB   = byte(250) // Sub Negotiation
-	GA   = byte(249) // Go Ahead
-	EL   = byte(248) // Erase Line
-	EC   = byte(247) // Erase Character
-	AYT  = byte(246) // Are You There
-	AO   = byte(245) // Abort Operation
-	IP   = byte(244) // Interrupt Process
-	BRK  = byte(243) // Break
-	NOP  = byte(241) // No operation
-	SE   = byte(240) // End of Subnegotiation
+	IAC   = byte(255)
+	DONT  = byte(254)
+	DO    = byte(253)
+	WONT  = byte(252)
+	WILL  = byte(251)
+	SB    = byte(250) // Sub Negotiation
+	GA    = byte(249) // Go Ahead
+	EL    = byte(248) // Erase Line
+	EC    = byte(247) // Erase Character
+	AYT   = byte(246) // Are You There
+	AO    = byte(245) // Abort Operation
+	IP    = byte(244) // Interrupt Process
+	BRK   = byte(243) // Break
+	DM    = byte(242) // Data Mark
+	NOP   = byte(241) // No operation
+	SE    = byte(240) // End of Subnegotiation
+	EOR   = byte(239) // End of Record
+	ABORT = byte(238) // Abort (LINEMODE)
+	SUSP  = byte(237) // Suspend Process (LINEMODE)
+	EOF   = byte(236) // End of File (LINEMODE)
 )
 
 // Options
 const (
-	BIN  = byte(0) // Binary Transmission
-	ECHO = byte(1)
-	REC  = byte(2)  // Reconnect
-	SGA  = byte(3)  // Suppress Go Ahead
-	LOG  = byte(18) // Logout
-	TSP  = byte(32) // Terminal Speed
-	RFC  = byte(33) // Remote Flow Control
+	BIN   = byte(0) // Binary Transmission
+	ECHO  = byte(1)
+	REC   = byte(2)  // Reconnect
+	SGA   = byte(3)  // Suppress Go Ahead
+	TM    = byte(6)  // Timing Mark
+	LOG   = byte(18) // Logout
+	TTYPE = byte(24) // Terminal Type
+	NAWS  = byte(31) // Negotiate About Window Size
+	TSP   = byte(32) // Terminal Speed
+	RFC   = byte(33) // Remote Flow Control
 )
 
 // Connection is a telnet interface which implements net.conn, along
 // with some proposed extended functionality for handling telnet options.
 type Connection interface {
 	// Read the data sent from the server after being processed
-	// for telnet options.
+	// for telnet options. Read blocks until at least one byte is available,
+	// then returns what has been processed so far, up to len(b), without
+	// waiting to fill b. Telnet commands are removed from the stream, so reads
+	// don't line up with the server's writes; use ReadFull to read an exact count.
+	// Connection errors are returned only after all data received before them
+	// has been read.
 	Read(b []byte) (n int, err error)
 	// Write the byte buffer to the output stream. Escaping 255 bytes is done
-	// automatically, so is not required by the caller. Note that the written
-	// count may be off due to the 255 byte escaping.
+	// automatically, so is not required by the caller. The written count
+	// doesn't include the added escapes.
 	Write(b []byte) (n int, err error)
+	// WriteNoTranslate writes like Write, but bypasses the line discipline, so it
+	// never translates newlines.
+	WriteNoTranslate(b []byte) (n int, err error)
+	// SetLineDiscipline sets how data is treated on top of IAC escaping, see
+	// LineDiscipline. It can be switched at any time. NVT is the default.
+	SetLineDiscipline(d LineDiscipline)
+	// SetTranslateNewlines sets whether Write sends a bare "\n" as the telnet
+	// newline "\r\n" (and a bare "\r" as "\r\x00") while the connection doesn't
+	// send binary, with NVT.TranslateNewlines. Off by default.
+	SetTranslateNewlines(on bool)
 	// Close the connection
 	// This is a pass-through method to the underlying net.conn
 	// without any processing.
@@ -62,15 +87,134 @@ type Connection interface {
 	// This is a pass-through method to the underlying net.conn
 	// without any processing.
 	RemoteAddr() net.Addr
-	// SetDeadline is a pass-through method to the underlying net.conn
-	// without any processing.
+	// SetDeadline sets the read deadline like SetReadDeadline, and the write
+	// deadline of the underlying net.conn.
 	SetDeadline(t time.Time) error
-	// SetReadDeadline is a pass-through method to the underlying net.conn
-	// without any processing.
+	// SetReadDeadline sets the deadline for Read, like net.Conn does: once it
+	// passes, Read returns ErrTimeout, including Reads already waiting, until the
+	// deadline is moved. A zero t means no deadline. The underlying net.conn keeps
+	// being read in the background, so nothing is lost to a timeout.
 	SetReadDeadline(t time.Time) error
 	// SetWriteDeadline is a pass-through method to the underlying net.conn
 	// without any processing.
 	SetWriteDeadline(t time.Time) error
+	// RegisterCommand sets the handler called when the server sends IAC <cmd> for a
+	// command without built-in handling, such as vendor specific command bytes.
+	// Passing a nil handler removes it.
+	RegisterCommand(cmd byte, h CommandHandler)
+	// SetTerminalType sets the terminal types the connection reports when the server
+	// asks with TTYPE (RFC 1091), in order of preference, such as "xterm-256color"
+	// and "ANSI". Each request from the server gets the next one, and the last is
+	// repeated once to mark the end of the list. TTYPE is refused while none are set,
+	// which is the default.
+	SetTerminalType(names ...string)
+	// SetWindowSize sets the window size the connection reports with NAWS (RFC 1073),
+	// in characters, and sends it right away if NAWS is on, so it can be called again
+	// whenever the window is resized. 0 means unknown. NAWS is refused until a size
+	// is set. Sizes over 65535 return ErrWindowSize.
+	SetWindowSize(width, height int) error
+	// SetEnviron sets the environment variables the connection reports when the
+	// server asks with NEW-ENVIRON (RFC 1572), such as USER and DISPLAY. Names RFC 1572
+	// defines are sent as VAR and any others as USERVAR. Once NEW-ENVIRON is on, the
+	// variables that changed are sent right away with INFO. Servers that only speak
+	// the original ENVIRON (RFC 1408) get the variables that way, and NEW-ENVIRON is
+	// preferred when they speak both. Both are refused until SetEnviron has been called.
+	SetEnviron(vars map[string]string) error
+	// SetRelay makes the connection pass the negotiation and subnegotiation it
+	// receives to w, exactly as received, instead of answering it, for proxies that
+	// leave negotiation to another telnet implementation on the other side. Answers
+	// from there go back with SendRawSequence. The state of each option, such as
+	// whether the server sends binary, follows what the two ends agree on, so the
+	// connection handles the data accordingly without answering anything twice.
+	// Timing marks sent by Ping are still answered here. Passing nil goes back to
+	// answering negotiation.
+	SetRelay(w io.Writer)
+	// ReadEvent reads like Read, but keeps the data and the option changes within it
+	// in order. It never reads past the point in the data where an option turned on
+	// or off, and once there returns the change as ev, with n = 0, before any of the
+	// data that came after it. For example, a server turning remote echo on before
+	// a password prompt is seen before the prompt. Commands are passed on the same
+	// way with SetCommandEvents. Changes that Read already read past are dropped.
+	ReadEvent(b []byte) (n int, ev *Event, err error)
+	// RemoteEcho reports whether the server echoes the data sent to it (RFC 857).
+	// The connection agrees when the server offers to, so a client that echoes
+	// locally should stop while it is on, as servers do around password prompts.
+	RemoteEcho() bool
+	// OnRemoteEcho sets a callback called whenever remote echo turns on or off.
+	// It runs on the connection's processing goroutine, after the data that came
+	// in along with the change has been processed.
+	OnRemoteEcho(fn func(on bool))
+	// RegisterOption sets the handler deciding on an option, in place of the
+	// defaults. Passing a nil handler goes back to the defaults.
+	RegisterOption(opt byte, h OptionHandler)
+	// SetCommandEvents sets whether the standard commands received without a
+	// handler, such as EOR, DM or the LINEMODE EOF, SUSP and ABORT, are passed to
+	// ReadEvent as events at their place in the data. Off by default, when they
+	// are ignored.
+	SetCommandEvents(on bool)
+	// SetUnknownCommand sets what happens to commands outside the standard set
+	// that have no registered handler. By default they are ignored.
+	SetUnknownCommand(p UnknownCommand)
+	// SendRawSequence writes one or more telnet commands to the server exactly as
+	// given, without escaping, after checking that they are well formed.
+	SendRawSequence(b ...byte) error
+	// SendCommand sends a two byte IAC <cmd> command such as AYT, IP, BRK or EOR.
+	SendCommand(cmd byte) error
+	// Control returns the out-of-band commands of the connection, grouped apart
+	// from the data path.
+	Control() Control
+	// Capabilities returns the features of the connection, both those built into
+	// the package and those negotiated with the peer, so frameworks can adapt.
+	Capabilities() Capabilities
+	// Stats returns a snapshot of the connection's counters.
+	Stats() Stats
+	// OnIgnored sets a callback called with each command counted in Stats.Ignored,
+	// such as to log them. It runs on the connection's processing goroutine, once
+	// the input the command came with has been parsed. Passing nil removes it.
+	OnIgnored(fn func(cmd byte))
+	// ResourceStats returns what the connection holds on to: goroutines, buffers
+	// and timers. Listener.ResourceStats sums it over a server's connections.
+	ResourceStats() ResourceStats
+	// TryRead reads whatever data is buffered, up to len(b), without blocking. ok is
+	// false if nothing was buffered. Once the connection has ended and all its data
+	// was read, TryRead returns 0, true and Read returns the reason.
+	TryRead(b []byte) (n int, ok bool)
+	// Readable returns a channel that receives a value when data is buffered or the
+	// connection ends. Only one signal is kept pending, so drain the buffer with
+	// TryRead until it returns false before waiting on the channel again.
+	Readable() <-chan struct{}
+	// Ping sends IAC DO TIMING-MARK and waits up to timeout for the server to answer
+	// it, which it must with either WILL or WONT. It is a quieter liveness check
+	// than AYT, which some servers log. It returns ErrNoTimingMark on timeout.
+	Ping(timeout time.Duration) error
+	// SetKeepalive sets how the connection keeps itself alive while idle, see Keepalive.
+	SetKeepalive(k Keepalive)
+	// Flush waits until all of the input received so far has been processed and the
+	// negotiation replies it led to have been written, or ctx is done. Data passed
+	// to Write is written before Write returns, so it needs no flushing.
+	Flush(ctx context.Context) error
+	// SetDrainTimeout sets how long Close waits to flush pending replies before
+	// closing the connection. 0, the default, closes right away.
+	SetDrainTimeout(d time.Duration)
+	// SetWatchdog sets up a watchdog for the input processing, see Watchdog.
+	SetWatchdog(w Watchdog)
+	// OnData registers fn to receive the server's data as it is decoded, instead of
+	// buffering it for Read. Data not read yet is delivered first. fn runs on the
+	// processing goroutine and b is only valid until it returns; while it runs no
+	// more input is processed, so a slow fn pushes back on the server once the input
+	// buffer fills. OnData(nil) goes back to buffering for Read.
+	OnData(fn func(b []byte))
+	// SetStripNUL sets whether NUL bytes are dropped from the server's data while
+	// it is in NVT mode, where RFC 854 treats them as padding, with NVT.StripNUL.
+	// Once the server negotiates binary transmission NULs are data and always
+	// kept. Off by default.
+	SetStripNUL(on bool)
+	// Done returns a channel that is closed once the connection has ended, through
+	// Close or a failure, and all of its background goroutines have exited.
+	Done() <-chan struct{}
+	// Err returns nil until Done is closed, and then the reason the connection
+	// ended: ErrClosed after Close, or the error that failed it.
+	Err() error
 	// Proposed methods
 	// SetOption tries to set the option through negotiation with
 	// the server.
@@ -82,117 +226,340 @@ type Connection interface {
 // Con is the internal telnet connection object.
 type conn struct {
 	net.Conn
-	quit      chan bool
-	buf       [][]byte
-	uLock     *sync.Mutex
-	eLock     *sync.Mutex
-	lastError error
-	i         *bytes.Buffer // in from the connection
-	u         *bytes.Buffer // upstream
+	ctx          context.Context
+	cancel       context.CancelFunc
+	running      int32 // background goroutines still running
+	timers       int32 // timers armed, for ResourceStats
+	held         int32 // capacity of the processing goroutine's buffers, for ResourceStats
+	done         chan struct{}
+	exited       func() // called once the background goroutines have exited
+	readable     chan struct{}
+	data         chan struct{} // signalled for Read when data is buffered
+	failed       chan struct{} // closed once lastError is set
+	wake         chan struct{} // wakes the processing goroutine to look at its settings again
+	stopOnce     sync.Once
+	err          error // why the connection ended
+	closeErr     error // from closing the underlying net.Conn
+	buf          [][]byte
+	uLock        *sync.Mutex
+	eLock        *sync.Mutex
+	lastError    error
+	i            *bytes.Buffer // in from the connection
+	u            *bytes.Buffer // upstream
+	replies      []byte        // negotiation replies waiting to be flushed
+	calls        []call        // handler callbacks waiting for the parsing pass to end
+	flushes      chan chan error
+	drainTimeout time.Duration
+	sb           []byte // scratch for subnegotiation payloads
+	lLock        sync.Mutex
+	limits       map[byte]*replyLimit
+	maxReplies   int // per option and second, set before starting; 0 is the default
+	cLock        sync.Mutex
+	commands     map[byte]CommandHandler
+	options      map[byte]OptionHandler
+	plugins      map[byte]OptionHandler // made from RegisterPlugin as options come up
+	ttype        *terminalType
+	naws         *windowSize
+	env          *environment
+	relay        *relay
+	echo         int32 // set while the server echoes, atomic
+	onEcho       func(on bool)
+	onIgnored    func(cmd byte)
+	echoReported bool // echo as last reported to onEcho, owned by the processing goroutine
+	// option changes for ReadEvent, and how much data was ever put in u, under mLock
+	mLock     sync.Mutex
+	marks     []mark
+	delivered uint64
+	consumed  uint64 // how much data was taken out of u, under uLock
+	dLock     sync.Mutex
+	deadline  time.Time     // for Read
+	moved     chan struct{} // closed when the read deadline changes
+	// enabled holds the sides of each option that are on, under cLock. Client side it
+	// covers the options with a handler, server side all of them.
+	enabled   map[byte]optSides
+	unknown   UnknownCommand
+	onData    func([]byte)
+	watchdog  Watchdog
+	tm        tmState
+	keep      Keepalive
+	lastInput time.Time // owned by the processing goroutine
+	// server holds the negotiation state of a connection accepted by a Listener
+	server *serverState
+	// transcript records negotiation while DialNegotiated waits for it to settle
+	transcript *transcript
+	// stuckSince is when the parser stopped making progress on pending input,
+	// and left how much input the last pass left, both owned by the processing goroutine
+	stuckSince time.Time
+	left       int
+	chunk      []byte         // scratch handed to onData
+	discipline LineDiscipline // under cLock, nil for NVT
+	upFn       func([]byte)   // c.up, for the line discipline, owned by the processing goroutine
+	cmdEvents  int32          // 1 if commands without a handler are passed to ReadEvent
+	binary     int32          // 1 if the server sends binary
+	sLock      sync.Mutex
+	ignored    map[byte]uint64
+	optStats   map[byte]OptionStats
+	gaps       []uint64 // gap histogram counts, by gapBounds
+	// byte counts of the network and the data in it, for Stats
+	wireIn, wireOut, dataIn, dataOut uint64
+	gapSum                           time.Duration
+	// lastArrival is when data last came in, owned by the socket reading goroutine
+	lastArrival time.Time
 }
 
 // Dial connects to a TCP endpoint and returns a Telnet Connection object,
 // which transparently handles telnet options and escaping.
 func Dial(network, address string) (Connection, error) {
-	fmt.Println("Dialing this: ", address)
-	var t conn
-	return t.dial(network, address)
+	var d Dialer
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects like Dial, giving up once ctx is done. ctx also bounds the
+// life of the connection: once it is done after connecting, the connection ends
+// as if it failed with ctx.Err(), which Read returns after any buffered data.
+func DialContext(ctx context.Context, network, address string) (Connection, error) {
+	var d Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+// NewConn runs the telnet protocol over an established connection, such as a TLS
+// connection or a socket through a proxy, and returns it as a Connection.
+// Closing the Connection closes nc.
+func NewConn(nc net.Conn) Connection {
+	c := &conn{}
+	c.start(nc)
+	return c
 }
 
 // Dial is a helper function for creating and connecting to a telnet session.
-func (c *conn) dial(network, address string) (Connection, error) {
-	var err error
-	c.Conn, err = net.Dial(network, address)
+// The connection is set up from d before it starts processing input, so the
+// first negotiation from the server already sees it.
+func (c *conn) dial(ctx context.Context, d *Dialer, network, address string) (Connection, error) {
+	if err := d.configure(c); err != nil {
+		return nil, err
+	}
+	nd := net.Dialer{Timeout: d.Timeout, LocalAddr: d.LocalAddr}
+	nc, err := nd.DialContext(ctx, network, address)
 	if err != nil {
 		return nil, err
 	}
-	c.quit = make(chan bool, 1)
+	c.startContext(ctx, nc)
+	return c, nil
+}
+
+// Start sets up the connection state around an established net.Conn,
+// and starts processing input from it.
+func (c *conn) start(nc net.Conn) {
+	c.startContext(context.Background(), nc)
+}
+
+// StartContext is start with a parent context, which ends the connection once done.
+func (c *conn) startContext(parent context.Context, nc net.Conn) {
+	c.Conn = nc
+	c.ctx, c.cancel = context.WithCancel(parent)
+	c.done = make(chan struct{})
+	c.lastInput = time.Now()
+	c.readable = make(chan struct{}, 1)
+	c.data = make(chan struct{}, 1)
+	c.failed = make(chan struct{})
+	c.wake = make(chan struct{}, 1)
+	c.flushes = make(chan chan error)
 	c.uLock = &sync.Mutex{}
 	c.eLock = &sync.Mutex{}
 	//tcp input
 	c.i = bytes.NewBuffer(nil)
 	//upstream
 	c.u = bytes.NewBuffer(nil)
-	go c.process()
-	return c, nil
+	in := getRing()
+	c.run(func() { c.buffer(in) }, func() { c.process(in) }, func() { c.watchParent(parent) })
 }
 
-// Read the current buffer sent from the server	fprint after being processed
-// for telnet options. This blocks until data is available.
+// WatchParent fails the connection once its parent context is done, so Read
+// reports why. It returns when the connection stops for any reason.
+func (c *conn) watchParent(parent context.Context) {
+	<-c.ctx.Done()
+	if err := parent.Err(); err != nil {
+		c.fail(err)
+	}
+}
+
+// Read the current buffer sent from the server after being processed
+// for telnet options. This blocks until data is available, and then returns
+// whatever is available up to len(b) without waiting for more.
 func (c *conn) Read(b []byte) (n int, err error) {
-	// otherwise push the processed data
-	c.uLock.Lock()
-	defer c.uLock.Unlock()
-	ready := c.u.Len() > 0
-	for !ready {
+	n, _, err = c.read(b, false)
+	return n, err
+}
+
+// read is Read, and also ReadEvent if events is set.
+func (c *conn) read(b []byte, events bool) (n int, ev *Event, err error) {
+	for {
+		// like net.Conn, a passed deadline wins over buffered data
+		deadline, moved := c.readDeadline()
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return 0, nil, ErrTimeout
+		}
+		c.uLock.Lock()
+		next, pending := c.nextEvent()
+		if events && pending && next.at == c.consumed {
+			c.uLock.Unlock()
+			return 0, c.takeEvent(), nil
+		}
+		if c.u.Len() > 0 {
+			p := b
+			// stop at the next change
+			if before := next.at - c.consumed; events && pending && uint64(len(p)) > before {
+				p = p[:before]
+			}
+			n, _ = c.u.Read(p)
+			c.consume(n)
+			// leave the signal for a concurrent Read to take the rest
+			if c.u.Len() > 0 || (events && pending) {
+				notify(c.data)
+			}
+			c.uLock.Unlock()
+			return n, nil, nil
+		}
 		// push connection errors upstream, only after buffer has been sent
 		c.eLock.Lock()
-		if c.lastError != nil {
-			return 0, c.lastError
-		}
+		err = c.lastError
 		c.eLock.Unlock()
-
 		c.uLock.Unlock()
-		time.Sleep(time.Duration(20) * time.Millisecond)
-		c.uLock.Lock()
-		ready = c.u.Len() > 0
+		if err != nil {
+			return 0, nil, err
+		}
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer = c.newTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+		select {
+		case <-c.data:
+		case <-c.failed:
+		case <-timeout:
+		case <-moved:
+		}
+		if timer != nil {
+			c.stopTimer(timer)
+		}
 	}
-	return c.u.Read(b)
+}
+
+// TryRead reads buffered data without blocking.
+func (c *conn) TryRead(b []byte) (n int, ok bool) {
+	c.uLock.Lock()
+	defer c.uLock.Unlock()
+	if c.u.Len() > 0 {
+		n, _ = c.u.Read(b)
+		c.consume(n)
+		return n, true
+	}
+	c.eLock.Lock()
+	defer c.eLock.Unlock()
+	return 0, c.lastError != nil
+}
+
+// Readable is signalled when data is buffered or the connection ends.
+func (c *conn) Readable() <-chan struct{} {
+	return c.readable
+}
+
+// ReadFull reads exactly len(b) bytes from the connection, across as many
+// reads as needed. It behaves like io.ReadFull: it returns io.ErrUnexpectedEOF
+// if the connection fails after only part of b was filled.
+func ReadFull(c Connection, b []byte) (n int, err error) {
+	return io.ReadFull(c, b)
 }
 
 // Write the byte buffer to the output stream. Escaping 255 bytes is done
-// automatically, so is not required by the caller. Note that the written
-// count may be off due to the 255 byte escaping. This will be fixed in future releases.
+// automatically, so is not required by the caller. The returned count is
+// the number of bytes of b written, not counting the added escapes.
+// The line discipline decides what goes out for b; by default, NVT, newlines
+// are written as given unless SetTranslateNewlines is enabled.
 // Currently not thread safe, although that functionality may be added later.
 func (c *conn) Write(b []byte) (n int, err error) {
-	l1 := len(b)
-	for i := 0; i < l1; i++ {
-		// If the stream contains a 255, then escape it by sending a second 255
-		if b[i] == IAC {
-			b = append(b, 0)
-			copy(b[i+1:], b[i:])
-			b[i] = byte(255)
-		}
+	return c.writeData(b, c.lineDiscipline().Output(b, c.localBinary()))
+}
+
+// WriteNoTranslate writes b like Write, but bypasses the line discipline, so
+// newlines are never translated, for binary payloads on a connection that
+// translates them.
+func (c *conn) WriteNoTranslate(b []byte) (n int, err error) {
+	return c.writeData(b, b)
+}
+
+// writeData sends out, the data of b after the line discipline, and counts b.
+func (c *conn) writeData(b, out []byte) (n int, err error) {
+	if len(out) > 0 {
+		_, err = c.write(encode(out))
 	}
+	if err != nil {
+		return 0, err
+	}
+	c.countOut(0, len(b))
+	return len(b), nil
+}
 
-	_, err = c.write(b)
-	// TODO: Calculate the deltas of what was written vs expected to calculate "upstream/assumed" written bytes
-	return l1, err
+// Encode escapes IAC bytes. b itself is left untouched.
+func encode(b []byte) []byte {
+	out := make([]byte, 0, len(b)+len(b)/8)
+	for _, c := range b {
+		if c == IAC {
+			// If the stream contains a 255, then escape it by sending a second 255
+			out = append(out, IAC, IAC)
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
 }
 
 func (c *conn) write(b []byte) (n int64, err error) {
 	c.buf = append(c.buf, b)
-	return (*net.Buffers)(&c.buf).WriteTo(c.Conn)
+	n, err = (*net.Buffers)(&c.buf).WriteTo(c.Conn)
+	c.countOut(int(n), 0)
+	return n, err
 }
 
-// Close the connection
-// This is a pass-through method to the underlying net.conn
-// without any processing.
+// Close the connection and stop its background goroutines. Data that was already
+// received can still be read, after which Read returns ErrClosed.
+// With a drain timeout set, pending replies are flushed first, see SetDrainTimeout.
+// Closing an already closed or failed connection does nothing.
 func (c *conn) Close() error {
-	c.quit <- true
-	return c.Conn.Close()
+	c.drain()
+	c.fail(ErrClosed)
+	return c.closeErr
 }
 
 // Buffer reads from the underlying TCP connection and buffers as necessary,
 // passing it onto process to handle Telnet commands.
-func (c *conn) buffer(quit chan bool, updates chan []byte, errors chan error) {
-	buf := make([]byte, 2048)
+// The read error is queued behind the data in the ring, so it is never seen
+// before the data that was read ahead of it.
+func (c *conn) buffer(in *ring) {
+	bp := bufPool.Get().(*[]byte)
+	defer bufPool.Put(bp)
+	defer in.release()
+	buf := *bp
 	for {
 		i, err := c.Conn.Read(buf)
+		if i > 0 {
+			c.arrived(time.Now())
+			c.countIn(i, 0)
+			if !in.write(buf[:i]) {
+				return
+			}
+		}
 		if err != nil {
-			errors <- err
+			in.close(err)
+			return
 		}
-		if i > 0 {
-			//fmt.Println("TX length", len(buf[:i]))
-			u := make([]byte, i)
-			copy(u, buf[:i])
-			updates <- u
-		} else {
+		if i == 0 {
 			time.Sleep(time.Duration(30) * time.Millisecond)
 		}
 		select {
-		case <-quit:
-			break
+		case <-c.ctx.Done():
+			return
 		default:
 		}
 	}
@@ -200,49 +567,164 @@ func (c *conn) buffer(quit chan bool, updates chan []byte, errors chan error) {
 
 // Process parses the buffer for telnet IAC commands,
 // and forwards on the results either upstream or to be handled as a telnet command.
-func (c *conn) process() {
-	bufquit := make(chan bool, 1)
-	updates := make(chan []byte, 2048)
-	errors := make(chan error, 2)
-
-	go c.buffer(bufquit, updates, errors)
+func (c *conn) process(in *ring) {
+	bp := bufPool.Get().(*[]byte)
+	defer bufPool.Put(bp)
+	defer in.release()
+	defer in.stop()
+	buf := *bp
+	// a read error is only passed on once the data before it has been processed
+	var readErr error
 
 	for {
-		toProcess := c.i.Len() > 0
-		if toProcess {
-			b := c.i.Bytes()
-			c.uLock.Lock()
-			//If no 255's exist, just copy and move on
-			if i := bytes.IndexByte(b, IAC); i == -1 {
-				c.i.WriteTo(c.u)
-			} else {
-				//handle the IAC here
-				//read from the input process up to, but not including, the 255
-				c.u.Write(c.i.Next(i))
-				c.processIAC()
-			}
-			c.uLock.Unlock()
+		var timer *time.Timer
+		var due <-chan time.Time
+		if d := c.keepaliveDue(time.Now()); d >= 0 {
+			timer = c.newTimer(d)
+			due = timer.C
 		}
 		select {
-		case <-c.quit:
-			bufquit <- true
+		case <-c.ctx.Done():
+			return
+		case <-in.readable:
+			readErr = c.take(in, buf)
+			c.pass()
+		case ack := <-c.flushes:
+			// input that was already read is answered before the flush completes
+			readErr = c.take(in, buf)
+			ack <- c.pass()
+		case <-due:
+			// answers that came in are parsed first
+			readErr = c.take(in, buf)
+			if c.i.Len() > 0 {
+				c.pass()
+			}
+			c.keepalive(time.Now())
+		case <-c.wake:
+			c.dispatch()
+		}
+		if timer != nil {
+			c.stopTimer(timer)
+		}
+		c.reportEcho()
+		if readErr != nil {
+			c.fail(readErr)
+			readErr = nil
+		}
+	}
+}
+
+// Take moves everything waiting in the ring into the input buffer, and returns
+// the read error queued behind it, if any.
+func (c *conn) take(in *ring, buf []byte) (readErr error) {
+	for {
+		n, err := in.read(buf)
+		if n > 0 {
+			c.lastInput = time.Now()
+		}
+		c.i.Write(buf[:n])
+		if err != nil {
+			readErr = err
+		}
+		if n == 0 {
+			return readErr
+		}
+	}
+}
+
+// Pass parses the input buffer, passing data upstream, and then sends the replies.
+func (c *conn) pass() error {
+	c.uLock.Lock()
+	before := c.i.Len()
+	c.parse()
+	c.watch(before)
+	if c.u.Len() > 0 {
+		notify(c.readable)
+		notify(c.data)
+	}
+	c.uLock.Unlock()
+	err := c.callbacks()
+	if e := c.flush(); err == nil {
+		err = e
+	}
+	c.dispatch()
+	atomic.StoreInt32(&c.held, int32(c.i.Cap()+cap(c.replies)+cap(c.sb)))
+	return err
+}
+
+// Fail records the first error of the connection, to be returned from Read
+// once the buffered data has been read, and stops the connection.
+func (c *conn) fail(err error) {
+	c.eLock.Lock()
+	if c.lastError == nil {
+		c.lastError = err
+	}
+	c.eLock.Unlock()
+	c.stop(err)
+	notify(c.readable)
+}
+
+// Parse consumes as much of the input process as possible, forwarding data upstream
+// and handling IAC sequences, and stops at the first incomplete sequence.
+func (c *conn) parse() {
+	before := c.u.Len()
+	defer func() { c.countIn(0, c.u.Len()-before) }()
+	for c.i.Len() > 0 {
+		b := c.i.Bytes()
+		//If no 255's exist, just copy and move on
+		i := bytes.IndexByte(b, IAC)
+		if i == -1 {
+			c.deliver(c.i.Next(len(b)))
 			return
-		case b := <-updates:
-			//fmt.Println("RX length", len(b))
-			c.i.Write(b)
-		case err := <-errors:
-			c.eLock.Lock()
-			c.lastError = err
-			c.eLock.Unlock()
-		default:
 		}
-		// If the input process is empty, that means the connection is also empty so let's wait a bit
-		if !toProcess {
-			time.Sleep(time.Duration(100) * time.Millisecond)
+		//read from the input process up to, but not including, the 255
+		c.deliver(c.i.Next(i))
+		l := c.i.Len()
+		c.processIAC()
+		// nothing was consumed, so the sequence is incomplete; wait for more data
+		if c.i.Len() == l {
+			return
 		}
 	}
 }
 
+// Deliver passes decoded data upstream through the line discipline.
+func (c *conn) deliver(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	if c.upFn == nil {
+		// made once, so delivering doesn't allocate a method value every time
+		c.upFn = c.up
+	}
+	c.lineDiscipline().Input(b, c.remoteBinary(), c.upFn)
+}
+
+// Reply queues a negotiation response to be sent on the next flush,
+// unless the option is over its reply limit. It reports whether it did, so
+// that a request left unanswered doesn't change the option either.
+func (c *conn) reply(cmd, opt byte) bool {
+	if !c.allow(opt) {
+		return false
+	}
+	c.replies = append(c.replies, IAC, cmd, opt)
+	if c.transcript != nil {
+		c.transcript.add(true, cmd, opt)
+	}
+	return true
+}
+
+// Flush writes all negotiation replies queued during a processing pass
+// as a single write, instead of one small segment per reply.
+func (c *conn) flush() error {
+	if len(c.replies) == 0 {
+		return nil
+	}
+	err := c.send(c.replies)
+	c.replies = c.replies[:0]
+	return err
+}
+
 // ProcessIAC determines if the IAC is an escaped 255 byte,
 // or an actual command to be processed. If it's an escaped byte, it removes
 // the duplication/escaping and forwards the buffer upstream.
@@ -255,7 +737,7 @@ func (c *conn) processIAC() {
 	// If this is an escaped 255, write a single 255 to the output process and move the
 	// pointer forwards twice
 	if b[0] == 255 && b[1] == 255 {
-		c.u.Write(c.i.Next(1))
+		c.up(c.i.Next(1))
 		_ = c.i.Next(1)
 		return
 	}
@@ -267,6 +749,36 @@ func (c *conn) processIAC() {
 func (c *conn) parseCommand(buff []byte) {
 	// iac := buff[0]
 	cmd := buff[1]
+	if cmd >= WILL && cmd <= DONT && len(buff) >= 3 {
+		c.countOption(buff[2], OptionStats{Negotiations: 1})
+		if c.transcript != nil {
+			c.transcript.add(false, cmd, buff[2])
+		}
+	}
+	if (cmd == WILL || cmd == WONT) && len(buff) >= 3 && buff[2] == TM && c.timingMark() {
+		// the answer to our DO TIMING-MARK, which isn't answered again
+		_ = c.i.Next(3)
+		return
+	}
+	if cmd >= WILL && cmd <= DONT && len(buff) >= 3 && c.relayed(buff[:3]) {
+		_ = c.i.Next(3)
+		return
+	}
+	if c.server != nil && cmd >= WILL && cmd <= DONT {
+		// wait for the option like the client side handlers do
+		if len(buff) >= 3 {
+			c.server.negotiate(c, cmd, buff[2])
+			_ = c.i.Next(3)
+		}
+		return
+	}
+	if cmd >= WILL && cmd <= DONT && len(buff) >= 3 {
+		if h := c.optionHandler(buff[2]); h != nil {
+			c.negotiateOption(h, cmd, buff[2])
+			_ = c.i.Next(3)
+			return
+		}
+	}
 	switch cmd {
 	case DONT:
 		c.dont(buff)
@@ -276,21 +788,16 @@ func (c *conn) parseCommand(buff []byte) {
 		c.wont(buff)
 	case WILL:
 		c.will(buff)
-	//case SB:
-	//	break
-	//case AYT:
-	//	break
-	//case NOP:
-	//	break
-	//case SE:
-	//	break
+	case SB:
+		c.subnegotiation(buff)
 	default:
-		break
+		c.command(cmd)
 	}
 }
 
 // Will responds to Telnet WILL commands.
-// By default it enables Stop-Go-Ahead, and refuses everything else.
+// By default it enables Stop-Go-Ahead from the server, and refuses everything else.
+// Binary transmission is negotiated by its option handler.
 func (c *conn) will(buf []byte) {
 	// if we don't have the option in the process yet, return and wait for more information
 	if len(buf) < 3 {
@@ -299,9 +806,9 @@ func (c *conn) will(buf []byte) {
 	opt := buf[2]
 	switch opt {
 	case SGA:
-		c.Conn.Write([]byte{255, DO, SGA})
+		c.reply(DO, SGA)
 	default:
-		c.Conn.Write([]byte{255, DONT, opt})
+		c.reply(DONT, opt)
 	}
 	// consume IAC, Cmd, and Option from the input process
 	_ = c.i.Next(3)
@@ -315,25 +822,19 @@ func (c *conn) dont(buf []byte) {
 		return
 	}
 	opt := buf[2]
-	c.Conn.Write([]byte{255, WONT, opt})
+	c.reply(WONT, opt)
 	// consume IAC, Cmd, and Option from the input process
 	_ = c.i.Next(3)
 }
 
 // Do responds to Telnet DO commands.
-// By default it accepts Binary transmissions, and refuses all other options.
+// By default it refuses all options without a handler.
 func (c *conn) do(buf []byte) {
 	// if we don't have the option in the process yet, return and wait for more information
 	if len(buf) < 3 {
 		return
 	}
-	opt := buf[2]
-	switch opt {
-	case BIN:
-		c.Conn.Write([]byte{255, WILL, BIN})
-	default:
-		c.Conn.Write([]byte{255, WONT, opt})
-	}
+	c.reply(WONT, buf[2])
 	// consume IAC, Cmd, and Option from the input process
 	c.i.Next(3)
 }
@@ -3,22 +3,25 @@ package gote
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"sync"
 	"testing"
+	"testing/quick"
 	"time"
 
-	"github.com/jordwest/mock-conn"
+	"github.com/morganhein/go-telnet/fake"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestEscapedIAC(t *testing.T) {
 	fmt.Println("")
 	tel := &conn{
-		i:    bytes.NewBuffer(nil),
-		u:    bytes.NewBuffer(nil),
-		quit: make(chan bool, 1),
+		i: bytes.NewBuffer(nil),
+		u: bytes.NewBuffer(nil),
 	}
 
 	tel.i.Write([]byte{IAC, IAC, 23})
@@ -32,8 +35,8 @@ func TestDo(t *testing.T) {
 		u: bytes.NewBuffer(nil),
 	}
 
-	c := mock_conn.NewConn()
-	tel.Conn = c.Client
+	client, server := fake.Pipe()
+	tel.Conn = client
 
 	go func() {
 		_, err := tel.i.Write([]byte{IAC, DO, ECHO})
@@ -41,9 +44,10 @@ func TestDo(t *testing.T) {
 			t.Fatal(err)
 		}
 		tel.processIAC()
+		tel.flush()
 	}()
 
-	s := c.Server
+	s := server
 	buf := make([]byte, 3)
 	_, _ = s.Read(buf)
 	assert.Equal(t, []byte{IAC, WONT, ECHO}, buf)
@@ -55,22 +59,23 @@ func TestWill(t *testing.T) {
 		u: bytes.NewBuffer(nil),
 	}
 
-	c := mock_conn.NewConn()
-	tel.Conn = c.Client
+	client, server := fake.Pipe()
+	tel.Conn = client
 
 	go func() {
-		_, err := tel.i.Write([]byte{IAC, WILL, ECHO})
+		_, err := tel.i.Write([]byte{IAC, WILL, LOG})
 		if err != nil {
 			t.Fatal(err)
 		}
 		tel.processIAC()
+		tel.flush()
 		tel.Conn.Close()
 	}()
 
-	s := c.Server
+	s := server
 	buf := make([]byte, 3)
 	_, _ = s.Read(buf)
-	assert.Equal(t, []byte{IAC, DONT, ECHO}, buf)
+	assert.Equal(t, []byte{IAC, DONT, LOG}, buf)
 }
 
 func TestWont(t *testing.T) {
@@ -79,8 +84,8 @@ func TestWont(t *testing.T) {
 		u: bytes.NewBuffer(nil),
 	}
 
-	c := mock_conn.NewConn()
-	tel.Conn = c.Client
+	client, _ := fake.Pipe()
+	tel.Conn = client
 
 	_, err := tel.i.Write([]byte{IAC, WONT, ECHO})
 	if err != nil {
@@ -98,21 +103,46 @@ func TestDont(t *testing.T) {
 		//iLock: &sync.Mutex{},
 	}
 
-	c := mock_conn.NewConn()
-	tel.Conn = c.Client
+	client, server := fake.Pipe()
+	tel.Conn = client
 
 	go func() {
-		_, err := tel.i.Write([]byte{IAC, DONT, ECHO})
+		_, err := tel.i.Write([]byte{IAC, DONT, LOG})
 		if err != nil {
 			t.Fatal(err)
 		}
 		tel.processIAC()
+		tel.flush()
 	}()
 
-	s := c.Server
+	s := server
 	buf := make([]byte, 3)
 	_, _ = s.Read(buf)
-	assert.Equal(t, []byte{IAC, WONT, ECHO}, buf)
+	assert.Equal(t, []byte{IAC, WONT, LOG}, buf)
+}
+
+func TestParse_CoalescesReplies(t *testing.T) {
+	tel := &conn{
+		i: bytes.NewBuffer(nil),
+		u: bytes.NewBuffer(nil),
+	}
+
+	client, server := fake.Pipe()
+	tel.Conn = client
+
+	go func() {
+		tel.i.Write([]byte{IAC, DO, LOG, 'a', IAC, WILL, LOG, IAC, DONT, LOG, IAC})
+		tel.parse()
+		tel.flush()
+	}()
+
+	s := server
+	buf := make([]byte, 12)
+	i, _ := s.Read(buf)
+	assert.Equal(t, []byte{IAC, WONT, LOG, IAC, DONT, LOG, IAC, WONT, LOG}, buf[:i])
+	assert.Equal(t, []byte{'a'}, tel.u.Bytes())
+	// the trailing IAC is incomplete and stays in the input process
+	assert.Equal(t, []byte{IAC}, tel.i.Bytes())
 }
 
 func TestBuffer(t *testing.T) {
@@ -232,3 +262,300 @@ func TestErrorPropagation(t *testing.T) {
 	wgServer.Done()
 	wgClient.Wait()
 }
+
+func TestRead_ShortReads(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	server.Write([]byte("abc"))
+	b := make([]byte, 10)
+	i, err := tel.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", string(b[:i]))
+
+	// data read before an error is always delivered first
+	server.Write([]byte{'d', IAC, IAC, 'e'})
+	server.Close()
+	i, err = ReadFull(tel, b[:3])
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{'d', IAC, 'e'}, b[:i])
+	_, err = tel.Read(b)
+	assert.Equal(t, io.EOF, err)
+	_, err = tel.Read(b)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestLifecycle_Close(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	assert.NoError(t, tel.Err())
+
+	server.Write([]byte("left over"))
+	time.Sleep(time.Duration(150) * time.Millisecond)
+	assert.NoError(t, tel.Close())
+	assert.NoError(t, tel.Close())
+	<-tel.Done()
+	assert.Equal(t, ErrClosed, tel.Err())
+
+	// data received before Close can still be read
+	b := make([]byte, 20)
+	i, err := tel.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "left over", string(b[:i]))
+	_, err = tel.Read(b)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestLifecycle_Failure(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	tel.SetUnknownCommand(FailUnknown)
+
+	server.Write([]byte{IAC, 100})
+	select {
+	case <-tel.Done():
+	case <-time.After(time.Second):
+		t.Fatal("connection didn't stop")
+	}
+	assert.Equal(t, UnknownCommandError(100), tel.Err())
+	// the underlying connection was closed too
+	_, err := server.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func BenchmarkRead(b *testing.B) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	chunk := bytes.Repeat([]byte("0123456789abcde\n"), 64)
+	buf := make([]byte, len(chunk))
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		server.Write(chunk)
+		if _, err := ReadFull(tel, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWrite_Escaping(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{Conn: client}
+
+	b := []byte{1, IAC, 2, IAC, IAC}
+	i, err := tel.Write(b)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, i)
+	assert.NoError(t, server.Expect([]byte{1, IAC, IAC, 2, IAC, IAC, IAC, IAC}, time.Second))
+	// the caller's buffer is left alone
+	assert.Equal(t, []byte{1, IAC, 2, IAC, IAC}, b)
+}
+
+func TestWrite_Newlines(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{Conn: client}
+
+	tel.Write([]byte("a\nb"))
+	assert.NoError(t, server.Expect([]byte("a\nb"), time.Second))
+
+	tel.SetTranslateNewlines(true)
+	i, err := tel.Write([]byte("a\nb\r\nc\rd\r"))
+	assert.NoError(t, err)
+	assert.Equal(t, 9, i)
+	assert.NoError(t, server.Expect([]byte("a\r\nb\r\nc\r\x00d\r\x00"), time.Second))
+
+	tel.WriteNoTranslate([]byte{'\n', IAC})
+	assert.NoError(t, server.Expect([]byte{'\n', IAC, IAC}, time.Second))
+}
+
+func TestParse_StripNUL(t *testing.T) {
+	tel := &conn{
+		i: bytes.NewBuffer(nil),
+		u: bytes.NewBuffer(nil),
+	}
+	tel.SetStripNUL(true)
+
+	tel.i.Write([]byte("a\x00b"))
+	tel.i.Write([]byte{IAC, WILL, BIN})
+	tel.i.Write([]byte("c\x00d"))
+	tel.i.Write([]byte{IAC, WONT, BIN})
+	tel.i.Write([]byte("e\x00f"))
+	tel.parse()
+	assert.Equal(t, "abc\x00def", tel.u.String())
+	assert.Equal(t, []byte{IAC, DO, BIN, IAC, DONT, BIN}, tel.replies)
+
+	// NULs are kept unless stripping is asked for
+	tel.u.Reset()
+	tel.SetStripNUL(false)
+	tel.i.Write([]byte("g\x00h"))
+	tel.parse()
+	assert.Equal(t, "g\x00h", tel.u.String())
+}
+
+// segments feeds stream to a fresh conn, split up by the given cut sizes, and
+// returns the decoded data and the replies.
+func segments(stream []byte, cuts []uint8) (data, replies []byte) {
+	client, server := fake.Pipe()
+	tel := &conn{
+		Conn: client,
+		i:    bytes.NewBuffer(nil),
+		u:    bytes.NewBuffer(nil),
+	}
+	for len(stream) > 0 {
+		n := len(stream)
+		if len(cuts) > 0 {
+			n = int(cuts[0])%8 + 1
+			cuts = cuts[1:]
+			if n > len(stream) {
+				n = len(stream)
+			}
+		}
+		tel.i.Write(stream[:n])
+		stream = stream[n:]
+		tel.parse()
+		// handler callbacks send the replies before them as they go
+		tel.callbacks()
+	}
+	tel.flush()
+	client.Close()
+	replies, _ = ioutil.ReadAll(server)
+	return tel.u.Bytes(), replies
+}
+
+func TestParse_SegmentationInvariant(t *testing.T) {
+	property := func(items []uint16, cuts []uint8) bool {
+		var stream, expected []byte
+		for _, it := range items {
+			b := byte(it)
+			switch it >> 8 % 7 {
+			case 0:
+				stream = append(stream, IAC, IAC)
+				expected = append(expected, IAC)
+			case 1:
+				stream = append(stream, IAC, DO, b%40)
+			case 2:
+				stream = append(stream, IAC, WILL, b%40)
+			case 3:
+				stream = append(stream, IAC, NOP)
+			case 4:
+				// subnegotiations carry no data, escaped IAC bytes included
+				stream = append(stream, IAC, SB, 24, b, IAC, IAC, 'x', IAC, SE)
+			default:
+				if b == IAC {
+					b = 'x'
+				}
+				stream = append(stream, b)
+				expected = append(expected, b)
+			}
+		}
+		wholeData, wholeReplies := segments(stream, nil)
+		data, replies := segments(stream, cuts)
+		return bytes.Equal(expected, wholeData) && bytes.Equal(expected, data) &&
+			bytes.Equal(wholeReplies, replies)
+	}
+	assert.NoError(t, quick.Check(property, &quick.Config{MaxCount: 500}))
+}
+
+func TestTryRead(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	b := make([]byte, 10)
+	_, ok := tel.TryRead(b)
+	assert.False(t, ok)
+
+	server.Write([]byte{'a', IAC, NOP, 'b'})
+	select {
+	case <-tel.Readable():
+	case <-time.After(time.Second):
+		t.Fatal("never readable")
+	}
+	n, ok := tel.TryRead(b)
+	assert.True(t, ok)
+	assert.Equal(t, "ab", string(b[:n]))
+	_, ok = tel.TryRead(b)
+	assert.False(t, ok)
+
+	// the end of the connection is signalled too
+	server.Close()
+	select {
+	case <-tel.Readable():
+	case <-time.After(time.Second):
+		t.Fatal("end never signalled")
+	}
+	n, ok = tel.TryRead(b)
+	assert.True(t, ok)
+	assert.Equal(t, 0, n)
+	_, err := tel.Read(b)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestDialContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = DialContext(ctx, "tcp", l.Addr().String())
+	assert.Error(t, err)
+
+	go func() {
+		s, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer s.Close()
+		s.Write([]byte("hi"))
+		time.Sleep(time.Second)
+	}()
+	ctx, cancel = context.WithCancel(context.Background())
+	tel, err := DialContext(ctx, "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 2)
+	_, err = ReadFull(tel, b)
+	assert.NoError(t, err)
+
+	// cancelling ends the connection
+	cancel()
+	select {
+	case <-tel.Done():
+	case <-time.After(time.Second):
+		t.Fatal("connection didn't stop")
+	}
+	assert.Equal(t, context.Canceled, tel.Err())
+	_, err = tel.Read(b)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestConn_Latency(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	// data and replies go through without waiting for a poll interval
+	b := make([]byte, 1)
+	for i := 0; i < 10; i++ {
+		start := time.Now()
+		server.Write([]byte{IAC, WILL, SGA, 'x'})
+		_, err := tel.Read(b)
+		assert.NoError(t, err)
+		assert.NoError(t, server.Expect([]byte{IAC, DO, SGA}, time.Second))
+		assert.True(t, time.Since(start) < time.Duration(50)*time.Millisecond, "round trip took %v", time.Since(start))
+	}
+}
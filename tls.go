@@ -0,0 +1,14 @@
+package gote
+
+import "crypto/tls"
+
+// DialTLS connects to a telnet server over TLS, as tls.Dial does, and runs telnet
+// over the encrypted connection, for servers speaking telnets (port 992).
+// A nil config uses the defaults.
+func DialTLS(network, address string, config *tls.Config) (Connection, error) {
+	nc, err := tls.Dial(network, address, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(nc), nil
+}
@@ -0,0 +1,99 @@
+package gote
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+// selfSigned returns a certificate for 127.0.0.1, and a pool trusting it.
+func selfSigned(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gote test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestDialTLS(t *testing.T) {
+	cert, pool := selfSigned(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			s, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer s.Close()
+				// writing runs the handshake
+				s.Write([]byte{'h', IAC, NOP, 'i'})
+				time.Sleep(time.Second)
+			}()
+		}
+	}()
+
+	tel, err := DialTLS("tcp", l.Addr().String(), &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tel.Close()
+	b := make([]byte, 2)
+	_, err = ReadFull(tel, b)
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", string(b))
+	assert.True(t, tel.Capabilities().Supports(FeatureTLS))
+
+	// the certificate is checked
+	_, err = DialTLS("tcp", l.Addr().String(), nil)
+	assert.Error(t, err)
+}
+
+func TestNewConn(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := NewConn(client)
+	defer tel.Close()
+	err := server.Play(time.Second, fake.Step{Send: []byte{IAC, WILL, SGA}, Expect: []byte{IAC, DO, SGA}})
+	assert.NoError(t, err)
+	assert.False(t, tel.Capabilities().Supports(FeatureTLS))
+
+	tel.Close()
+	// closing the Connection closes the one under it
+	_, err = client.Write([]byte("x"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+package gote
+
+import "sync"
+
+// terminalType answers TTYPE requests with the configured terminal types.
+type terminalType struct {
+	BaseOption
+
+	mu    sync.Mutex
+	names []string
+	next  int
+}
+
+// SetTerminalType sets the terminal types reported to the server.
+func (c *conn) SetTerminalType(names ...string) {
+	c.cLock.Lock()
+	defer c.cLock.Unlock()
+	if len(names) == 0 {
+		c.ttype = nil
+		return
+	}
+	c.ttype = &terminalType{names: append([]string(nil), names...)}
+}
+
+// Accept agrees to report terminal types.
+func (t *terminalType) Accept(cmd byte) bool {
+	return cmd == DO
+}
+
+// Enabled starts the list over.
+func (t *terminalType) Enabled(c Connection, cmd byte) {
+	t.mu.Lock()
+	t.next = 0
+	t.mu.Unlock()
+}
+
+// Subnegotiation answers IAC SB TTYPE SEND IAC SE with the next terminal type.
+// After the last one has been sent twice, the list starts over.
+func (t *terminalType) Subnegotiation(c Connection, payload []byte) error {
+	q, _, err := SplitQualifier(payload)
+	if err != nil || q != SEND {
+		return nil
+	}
+	t.mu.Lock()
+	i := t.next
+	if i >= len(t.names) {
+		i = len(t.names) - 1
+		t.next = 0
+	} else {
+		t.next++
+	}
+	name := t.names[i]
+	t.mu.Unlock()
+	return c.SendRawSequence(Subnegotiation(TTYPE, IS, []byte(name))...)
+}
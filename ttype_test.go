@@ -0,0 +1,32 @@
+package gote
+
+import (
+	"testing"
+	"time"
+
+	"github.com/morganhein/go-telnet/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerminalType(t *testing.T) {
+	client, server := fake.Pipe()
+	tel := &conn{}
+	tel.start(client)
+	defer tel.Close()
+
+	// refused until terminal types are set
+	err := server.Play(time.Second, fake.Step{Send: []byte{IAC, DO, TTYPE}, Expect: []byte{IAC, WONT, TTYPE}})
+	assert.NoError(t, err)
+
+	tel.SetTerminalType("XTERM-256COLOR", "ANSI")
+	send := []byte{IAC, SB, TTYPE, byte(SEND), IAC, SE}
+	err = server.Play(time.Second,
+		fake.Step{Send: []byte{IAC, DO, TTYPE}, Expect: []byte{IAC, WILL, TTYPE}},
+		fake.Step{Send: send, Expect: Subnegotiation(TTYPE, IS, []byte("XTERM-256COLOR"))},
+		fake.Step{Send: send, Expect: Subnegotiation(TTYPE, IS, []byte("ANSI"))},
+		// the last one is repeated to mark the end, then the list starts over
+		fake.Step{Send: send, Expect: Subnegotiation(TTYPE, IS, []byte("ANSI"))},
+		fake.Step{Send: send, Expect: Subnegotiation(TTYPE, IS, []byte("XTERM-256COLOR"))},
+	)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,18 @@
+package vt_test
+
+import (
+	"fmt"
+
+	"github.com/morganhein/go-telnet/vt"
+)
+
+func ExampleScreen() {
+	s := vt.NewScreen(20, 2)
+	fmt.Fprint(s, "\x1b[2J\x1b[1;1HHP: 10\r\n\x1b[31mready\x1b[0m")
+	for _, line := range s.Lines() {
+		fmt.Printf("%q\n", line)
+	}
+	// Output:
+	// "HP: 10"
+	// "ready"
+}
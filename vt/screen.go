@@ -0,0 +1,423 @@
+// Package vt keeps a virtual screen from a decoded VT100 style stream, such as the
+// data read from a Connection, so what a console currently shows can be rendered as
+// text. It understands cursor movement, erasing, scrolling regions and the usual
+// control characters; attributes like colour are parsed and dropped.
+package vt
+
+import (
+	"strings"
+	"sync"
+)
+
+// Screen is a virtual terminal screen. It is an io.Writer, so a stream can be
+// copied into it, and safe to render from another goroutine while it is written to.
+type Screen struct {
+	mu     sync.Mutex
+	w, h   int
+	cells  [][]rune
+	x, y   int
+	top    int // scrolling region, inclusive
+	bottom int
+	savedX int
+	savedY int
+	// wrap is set once a character was written in the last column; the next one
+	// goes to the start of the following line.
+	wrap bool
+
+	state  int
+	params []int
+	cur    int
+	has    bool
+	priv   bool
+	utf    []byte
+}
+
+// Parser states.
+const (
+	ground = iota
+	escape
+	csi
+	osc
+	oscEsc
+	charset
+)
+
+// NewScreen returns a blank screen of the given size.
+func NewScreen(width, height int) *Screen {
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	s := &Screen{w: width, h: height}
+	s.reset()
+	return s
+}
+
+// reset blanks the screen and homes the cursor.
+func (s *Screen) reset() {
+	s.cells = make([][]rune, s.h)
+	for i := range s.cells {
+		s.cells[i] = blank(s.w)
+	}
+	s.x, s.y, s.wrap = 0, 0, false
+	s.top, s.bottom = 0, s.h-1
+	s.savedX, s.savedY = 0, 0
+}
+
+func blank(n int) []rune {
+	r := make([]rune, n)
+	for i := range r {
+		r[i] = ' '
+	}
+	return r
+}
+
+// Size returns the width and height of the screen.
+func (s *Screen) Size() (width, height int) {
+	return s.w, s.h
+}
+
+// Cursor returns the cursor position, zero based.
+func (s *Screen) Cursor() (x, y int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.x, s.y
+}
+
+// Write feeds b to the screen. It never fails.
+func (s *Screen) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range b {
+		s.feed(c)
+	}
+	return len(b), nil
+}
+
+// Lines returns the screen as text, one string per line with trailing blanks trimmed.
+func (s *Screen) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines := make([]string, s.h)
+	for i, row := range s.cells {
+		lines[i] = strings.TrimRight(string(row), " ")
+	}
+	return lines
+}
+
+// String renders the screen as text, with trailing blank lines removed.
+func (s *Screen) String() string {
+	lines := s.Lines()
+	n := len(lines)
+	for n > 0 && lines[n-1] == "" {
+		n--
+	}
+	return strings.Join(lines[:n], "\n")
+}
+
+func (s *Screen) feed(c byte) {
+	switch s.state {
+	case escape:
+		s.escape(c)
+		return
+	case csi:
+		s.csi(c)
+		return
+	case osc:
+		// operating system commands end with BEL or ESC \
+		switch c {
+		case 7:
+			s.state = ground
+		case 0x1b:
+			s.state = oscEsc
+		}
+		return
+	case oscEsc:
+		s.state = ground
+		return
+	case charset:
+		s.state = ground
+		return
+	}
+
+	if len(s.utf) > 0 || c >= 0x80 {
+		s.utf8(c)
+		return
+	}
+	switch c {
+	case 0x1b:
+		s.state = escape
+	case '\r':
+		s.x, s.wrap = 0, false
+	case '\n', 0x0b, 0x0c:
+		s.wrap = false
+		s.lineFeed()
+	case '\b':
+		if s.x > 0 {
+			s.x--
+		}
+		s.wrap = false
+	case '\t':
+		s.x = (s.x/8 + 1) * 8
+		if s.x >= s.w {
+			s.x = s.w - 1
+		}
+	default:
+		if c >= 0x20 && c != 0x7f {
+			s.put(rune(c))
+		}
+	}
+}
+
+// utf8 collects the bytes of a multi byte UTF-8 character. Bytes that don't form
+// valid UTF-8 are shown as the replacement character.
+func (s *Screen) utf8(c byte) {
+	if len(s.utf) == 0 {
+		switch {
+		case c&0xe0 == 0xc0, c&0xf0 == 0xe0, c&0xf8 == 0xf0:
+			s.utf = append(s.utf, c)
+		default:
+			s.put('�')
+		}
+		return
+	}
+	if c&0xc0 != 0x80 {
+		s.utf = s.utf[:0]
+		s.put('�')
+		s.feed(c)
+		return
+	}
+	s.utf = append(s.utf, c)
+	need := 2
+	switch {
+	case s.utf[0]&0xf0 == 0xe0:
+		need = 3
+	case s.utf[0]&0xf8 == 0xf0:
+		need = 4
+	}
+	if len(s.utf) == need {
+		r := []rune(string(s.utf))
+		s.utf = s.utf[:0]
+		s.put(r[0])
+	}
+}
+
+func (s *Screen) put(r rune) {
+	if s.wrap {
+		s.x, s.wrap = 0, false
+		s.lineFeed()
+	}
+	s.cells[s.y][s.x] = r
+	if s.x == s.w-1 {
+		s.wrap = true
+	} else {
+		s.x++
+	}
+}
+
+// lineFeed moves the cursor down, scrolling at the bottom of the scrolling region.
+func (s *Screen) lineFeed() {
+	if s.y == s.bottom {
+		s.scrollUp(1)
+	} else if s.y < s.h-1 {
+		s.y++
+	}
+}
+
+func (s *Screen) reverseLineFeed() {
+	if s.y == s.top {
+		s.scrollDown(1)
+	} else if s.y > 0 {
+		s.y--
+	}
+}
+
+func (s *Screen) scrollUp(n int) {
+	for ; n > 0; n-- {
+		copy(s.cells[s.top:s.bottom], s.cells[s.top+1:s.bottom+1])
+		s.cells[s.bottom] = blank(s.w)
+	}
+}
+
+func (s *Screen) scrollDown(n int) {
+	for ; n > 0; n-- {
+		copy(s.cells[s.top+1:s.bottom+1], s.cells[s.top:s.bottom])
+		s.cells[s.top] = blank(s.w)
+	}
+}
+
+func (s *Screen) escape(c byte) {
+	s.state = ground
+	switch c {
+	case '[':
+		s.state = csi
+		s.params, s.cur, s.has, s.priv = s.params[:0], 0, false, false
+	case ']':
+		s.state = osc
+	case '(', ')', '*', '+':
+		s.state = charset
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.x = 0
+		s.lineFeed()
+	case 'M':
+		s.reverseLineFeed()
+	case '7':
+		s.savedX, s.savedY = s.x, s.y
+	case '8':
+		s.x, s.y, s.wrap = s.savedX, s.savedY, false
+	case 'c':
+		s.reset()
+	}
+}
+
+func (s *Screen) csi(c byte) {
+	switch {
+	case c >= '0' && c <= '9':
+		s.cur = s.cur*10 + int(c-'0')
+		s.has = true
+		return
+	case c == ';':
+		s.params = append(s.params, s.cur)
+		s.cur, s.has = 0, false
+		return
+	case c == '?':
+		s.priv = true
+		return
+	case c < 0x40:
+		// other intermediate bytes are ignored
+		return
+	}
+	if s.has || len(s.params) > 0 {
+		s.params = append(s.params, s.cur)
+	}
+	s.state = ground
+	if s.priv {
+		// private modes (cursor visibility, alternate screen, ...) don't change the text
+		return
+	}
+	s.wrap = false
+	switch c {
+	case 'A':
+		s.y = clamp(s.y-s.param(0, 1), 0, s.h-1)
+	case 'B':
+		s.y = clamp(s.y+s.param(0, 1), 0, s.h-1)
+	case 'C':
+		s.x = clamp(s.x+s.param(0, 1), 0, s.w-1)
+	case 'D':
+		s.x = clamp(s.x-s.param(0, 1), 0, s.w-1)
+	case 'G':
+		s.x = clamp(s.param(0, 1)-1, 0, s.w-1)
+	case 'd':
+		s.y = clamp(s.param(0, 1)-1, 0, s.h-1)
+	case 'H', 'f':
+		s.y = clamp(s.param(0, 1)-1, 0, s.h-1)
+		s.x = clamp(s.param(1, 1)-1, 0, s.w-1)
+	case 'J':
+		s.eraseDisplay(s.param(0, 0))
+	case 'K':
+		s.eraseLine(s.param(0, 0))
+	case 'L':
+		if s.y >= s.top && s.y <= s.bottom {
+			top := s.top
+			s.top = s.y
+			s.scrollDown(clamp(s.param(0, 1), 1, s.h))
+			s.top = top
+		}
+	case 'M':
+		if s.y >= s.top && s.y <= s.bottom {
+			top := s.top
+			s.top = s.y
+			s.scrollUp(clamp(s.param(0, 1), 1, s.h))
+			s.top = top
+		}
+	case 'P':
+		row := s.cells[s.y]
+		n := clamp(s.param(0, 1), 1, s.w-s.x)
+		copy(row[s.x:], row[s.x+n:])
+		for i := s.w - n; i < s.w; i++ {
+			row[i] = ' '
+		}
+	case '@':
+		row := s.cells[s.y]
+		n := clamp(s.param(0, 1), 1, s.w-s.x)
+		copy(row[s.x+n:], row[s.x:])
+		for i := s.x; i < s.x+n; i++ {
+			row[i] = ' '
+		}
+	case 'X':
+		row := s.cells[s.y]
+		n := clamp(s.param(0, 1), 1, s.w-s.x)
+		for i := s.x; i < s.x+n; i++ {
+			row[i] = ' '
+		}
+	case 'S':
+		s.scrollUp(clamp(s.param(0, 1), 1, s.h))
+	case 'T':
+		s.scrollDown(clamp(s.param(0, 1), 1, s.h))
+	case 'r':
+		top, bottom := s.param(0, 1)-1, s.param(1, s.h)-1
+		if top < bottom && top >= 0 && bottom < s.h {
+			s.top, s.bottom = top, bottom
+			s.x, s.y = 0, 0
+		}
+	case 's':
+		s.savedX, s.savedY = s.x, s.y
+	case 'u':
+		s.x, s.y = s.savedX, s.savedY
+	}
+}
+
+// param returns parameter i, or def if it is missing or zero.
+func (s *Screen) param(i, def int) int {
+	if i >= len(s.params) || s.params[i] == 0 {
+		return def
+	}
+	return s.params[i]
+}
+
+func (s *Screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseLine(0)
+		for y := s.y + 1; y < s.h; y++ {
+			s.cells[y] = blank(s.w)
+		}
+	case 1:
+		s.eraseLine(1)
+		for y := 0; y < s.y; y++ {
+			s.cells[y] = blank(s.w)
+		}
+	case 2, 3:
+		for y := range s.cells {
+			s.cells[y] = blank(s.w)
+		}
+	}
+}
+
+func (s *Screen) eraseLine(mode int) {
+	row := s.cells[s.y]
+	from, to := 0, s.w
+	switch mode {
+	case 0:
+		from = s.x
+	case 1:
+		to = s.x + 1
+	}
+	for i := from; i < to; i++ {
+		row[i] = ' '
+	}
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
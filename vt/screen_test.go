@@ -0,0 +1,58 @@
+package vt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScreen_Text(t *testing.T) {
+	s := NewScreen(10, 3)
+	s.Write([]byte("hello\r\nworld"))
+	assert.Equal(t, "hello\nworld", s.String())
+	x, y := s.Cursor()
+	assert.Equal(t, 5, x)
+	assert.Equal(t, 1, y)
+
+	// wrapping and scrolling off the top
+	s.Write([]byte("\r\n0123456789ab"))
+	assert.Equal(t, []string{"world", "0123456789", "ab"}, s.Lines())
+}
+
+func TestScreen_Cursor(t *testing.T) {
+	s := NewScreen(10, 4)
+	s.Write([]byte("\x1b[2J\x1b[2;3Hx\x1b[Ay\x1b[3Cz\x1b[4;1H\x1b[1mbold\x1b[0m"))
+	assert.Equal(t, []string{"   y   z", "  x", "", "bold"}, s.Lines())
+
+	// erase to the end of the line and the display
+	s.Write([]byte("\x1b[1;5H\x1b[K\x1b[2;2H\x1b[J"))
+	assert.Equal(t, []string{"   y", "", "", ""}, s.Lines())
+
+	s.Write([]byte("\x1bc"))
+	assert.Equal(t, "", s.String())
+}
+
+func TestScreen_Edit(t *testing.T) {
+	s := NewScreen(8, 2)
+	s.Write([]byte("abcdef\r\x1b[2C\x1b[2P"))
+	assert.Equal(t, "abef", s.String())
+	s.Write([]byte("\x1b[1@"))
+	assert.Equal(t, "ab ef", s.String())
+	s.Write([]byte("\b\bX\x1b[G\x1b[3X"))
+	assert.Equal(t, "   ef", s.String())
+}
+
+func TestScreen_ScrollRegion(t *testing.T) {
+	s := NewScreen(5, 4)
+	s.Write([]byte("top\r\n1\r\n2\r\nbot"))
+	s.Write([]byte("\x1b[2;3r\x1b[3;1H\nnew"))
+	assert.Equal(t, []string{"top", "2", "new", "bot"}, s.Lines())
+	s.Write([]byte("\x1b[2;1H\x1bM"))
+	assert.Equal(t, []string{"top", "", "2", "bot"}, s.Lines())
+}
+
+func TestScreen_IgnoresOther(t *testing.T) {
+	s := NewScreen(20, 1)
+	s.Write([]byte("\x1b]0;title\x07\x1b(B\x1b[?25lé\xe2\x82\xac\xff!"))
+	assert.Equal(t, "é€�!", s.String())
+}
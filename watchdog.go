@@ -0,0 +1,88 @@
+package gote
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// maxWatchdogDump is the most pending input included in a watchdog report.
+const maxWatchdogDump = 32
+
+// Watchdog watches for the input processing getting stuck: input is pending and
+// more keeps arriving, but none of it is consumed. That only happens through a bug,
+// or a server sending something the parser can't get past, and otherwise hangs the
+// connection forever.
+type Watchdog struct {
+	// Period is how long the parser may go without progress before the watchdog
+	// fires. Zero disables the watchdog, which is the default.
+	Period time.Duration
+	// Reset makes the watchdog discard the stuck input up to the next IAC, so
+	// processing can carry on from there.
+	Reset bool
+	// Report, if set, is called with a description of the stuck state when the
+	// watchdog fires. It runs on the processing goroutine, once the parsing pass
+	// it fired in is over.
+	Report func(state string)
+}
+
+// SetWatchdog sets up a watchdog for the input processing.
+func (c *conn) SetWatchdog(w Watchdog) {
+	c.cLock.Lock()
+	c.watchdog = w
+	c.cLock.Unlock()
+}
+
+// Watch checks on the progress of a parse pass, given how much input was pending
+// before it.
+func (c *conn) watch(before int) {
+	c.cLock.Lock()
+	w := c.watchdog
+	c.cLock.Unlock()
+
+	after := c.i.Len()
+	arrived := before > c.left
+	c.left = after
+	if w.Period <= 0 || after == 0 || after < before {
+		c.stuckSince = time.Time{}
+		return
+	}
+	now := time.Now()
+	if c.stuckSince.IsZero() {
+		if arrived && before > 0 {
+			c.stuckSince = now
+		}
+		return
+	}
+	stuck := now.Sub(c.stuckSince)
+	if stuck < w.Period {
+		return
+	}
+	c.stuckSince = time.Time{}
+	if w.Report != nil {
+		b := c.i.Bytes()
+		if len(b) > maxWatchdogDump {
+			b = b[:maxWatchdogDump]
+		}
+		state := fmt.Sprintf("gote: input processing stuck for %v with %d bytes pending: % x", stuck, after, b)
+		c.later(func() { w.Report(state) })
+	}
+	if w.Reset {
+		c.skip()
+		c.left = c.i.Len()
+	}
+}
+
+// skip discards the input up to the next IAC after the first byte, or just the
+// first two bytes if there is none, so the rest is parsed as data.
+func (c *conn) skip() {
+	b := c.i.Bytes()
+	n := 2
+	if i := bytes.IndexByte(b[1:], IAC); i != -1 {
+		n = i + 1
+	}
+	if n > len(b) {
+		n = len(b)
+	}
+	c.i.Next(n)
+}
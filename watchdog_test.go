@@ -0,0 +1,56 @@
+package gote
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdog(t *testing.T) {
+	tel := &conn{
+		i: bytes.NewBuffer(nil),
+		u: bytes.NewBuffer(nil),
+	}
+	var reports []string
+	tel.SetWatchdog(Watchdog{
+		Period: time.Duration(20) * time.Millisecond,
+		Reset:  true,
+		Report: func(state string) {
+			reports = append(reports, state)
+		},
+	})
+	pass := func() {
+		before := tel.i.Len()
+		tel.parse()
+		tel.watch(before)
+		tel.callbacks()
+	}
+
+	// an incomplete sequence with nothing more arriving is just waiting
+	tel.i.Write([]byte{'a', IAC})
+	pass()
+	time.Sleep(time.Duration(30) * time.Millisecond)
+	pass()
+	assert.Empty(t, reports)
+	tel.i.Write([]byte{NOP})
+	pass()
+	assert.Equal(t, "a", tel.u.String())
+
+	// a subnegotiation that never ends, while more input piles up behind it
+	tel.i.Write([]byte{IAC, SB})
+	pass()
+	tel.i.Write([]byte{24, 0, 'x', 'b'})
+	pass()
+	time.Sleep(time.Duration(30) * time.Millisecond)
+	pass()
+	if assert.Len(t, reports, 1) {
+		assert.True(t, strings.Contains(reports[0], "6 bytes pending: ff fa 18 00 78 62"), reports[0])
+	}
+	// the reset dropped IAC SB, and the rest was parsed as data
+	pass()
+	assert.Equal(t, "a\x18\x00xb", tel.u.String())
+	assert.Equal(t, 0, tel.i.Len())
+}